@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+//go:embed assets/openapi.json
+var openAPIDocument []byte
+
+// maxAPIJobs is how many jobs the API remembers. The oldest finished jobs
+// are forgotten first; their manifests stay on disk.
+const maxAPIJobs = 1000
+
+// apiJob is one asynchronous generation submitted through the API.
+type apiJob struct {
+	ID           string              `json:"id"`
+	Status       string              `json:"status"`
+	Request      generationRequest   `json:"request"`
+	CreatedAt    string              `json:"created_at"`
+	StartedAt    string              `json:"started_at,omitempty"`
+	FinishedAt   string              `json:"finished_at,omitempty"`
+	ImageURL     string              `json:"image_url,omitempty"`
+	ManifestPath string              `json:"manifest_path,omitempty"`
+	Manifest     *warhol.Manifest    `json:"manifest,omitempty"`
+	Error        *warhol.ErrorDetail `json:"error,omitempty"`
+}
+
+// jobQueue runs API jobs on a fixed number of workers. Submissions beyond
+// the queue capacity are refused rather than buffered without bound.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*apiJob
+	order   []string
+	pending chan *apiJob
+}
+
+func newJobQueue(capacity int) *jobQueue {
+	return &jobQueue{jobs: make(map[string]*apiJob), pending: make(chan *apiJob, capacity)}
+}
+
+// start launches workers that run jobs with generate until ctx is done.
+func (q *jobQueue) start(ctx context.Context, workers int, generate func(context.Context, generationRequest) (warhol.Result, error)) {
+	for range workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.pending:
+					q.update(job.ID, func(job *apiJob) {
+						job.Status = "running"
+						job.StartedAt = time.Now().UTC().Format(time.RFC3339)
+					})
+					result, err := generate(ctx, job.Request)
+					q.finish(job.ID, result, err)
+				}
+			}
+		}()
+	}
+}
+
+func (q *jobQueue) submit(req generationRequest) (apiJob, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return apiJob{}, err
+	}
+	job := &apiJob{
+		ID:        hex.EncodeToString(id),
+		Status:    "queued",
+		Request:   req,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.pending <- job:
+	default:
+		return apiJob{}, warhol.WithCode(errQueueFull, fmt.Errorf("generation queue is full (%d jobs waiting)", cap(q.pending)))
+	}
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.evict()
+	return *job, nil
+}
+
+func (q *jobQueue) get(id string) (apiJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return apiJob{}, false
+	}
+	return *job, true
+}
+
+func (q *jobQueue) update(id string, fn func(*apiJob)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (q *jobQueue) finish(id string, result warhol.Result, err error) {
+	q.update(id, func(job *apiJob) {
+		job.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		job.ManifestPath = result.ManifestPath
+		if result.ManifestPath != "" {
+			job.Manifest = &result.Manifest
+		}
+		if err != nil {
+			detail := warhol.Describe(err)
+			job.Status = "failed"
+			job.Error = &detail
+			return
+		}
+		job.Status = "succeeded"
+		if result.ImagePath != "" {
+			job.ImageURL = "/v1/generations/" + job.ID + "/image"
+		}
+	})
+}
+
+// evict forgets the oldest finished jobs beyond maxAPIJobs. The caller
+// holds q.mu.
+func (q *jobQueue) evict() {
+	for i := 0; len(q.order) > maxAPIJobs && i < len(q.order); {
+		job := q.jobs[q.order[i]]
+		if job.Status == "queued" || job.Status == "running" {
+			i++
+			continue
+		}
+		delete(q.jobs, job.ID)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+	}
+}
+
+func (s *server) apiRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/openapi.json", s.handleOpenAPI)
+	mux.Handle("GET /v1/styles", s.requireToken(http.HandlerFunc(s.handleAPIStyles)))
+	mux.Handle("GET /v1/characters", s.requireToken(http.HandlerFunc(s.handleAPICharacters)))
+	mux.Handle("POST /v1/generations", s.requireToken(http.HandlerFunc(s.handleCreateGeneration)))
+	mux.Handle("GET /v1/generations/{id}", s.requireToken(http.HandlerFunc(s.handleGetGeneration)))
+	mux.Handle("GET /v1/generations/{id}/image", s.requireToken(http.HandlerFunc(s.handleGenerationImage)))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeHTTPJSON(w, http.StatusNotFound, errorDocument{Error: warhol.ErrorDetail{Code: warhol.CodeUsage, Message: "not found: " + r.Method + " " + r.URL.Path}})
+	})
+	if s.token == "" {
+		// Without a token, only the Host check keeps web pages from
+		// reaching the API through DNS rebinding.
+		return s.logRequests(s.requireSameOrigin(mux))
+	}
+	return s.logRequests(mux)
+}
+
+// requireToken rejects requests without the configured bearer token. With
+// no token configured every request is allowed.
+func (s *server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="warhol"`)
+				writeHTTPJSON(w, http.StatusUnauthorized, errorDocument{Error: warhol.ErrorDetail{Code: warhol.CodeAuth, Message: "missing or invalid bearer token"}})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func (s *server) handleAPIStyles(w http.ResponseWriter, r *http.Request) {
+	styles, err := s.client.ListStyles()
+	if err != nil {
+		writeHTTPError(w, warhol.WithCode(warhol.CodeIO, err))
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, map[string][]warhol.ProfileSummary{"styles": styles})
+}
+
+func (s *server) handleAPICharacters(w http.ResponseWriter, r *http.Request) {
+	characters, err := s.client.ListCharacters()
+	if err != nil {
+		writeHTTPError(w, warhol.WithCode(warhol.CodeIO, err))
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, map[string][]warhol.ProfileSummary{"characters": characters})
+}
+
+func (s *server) handleCreateGeneration(w http.ResponseWriter, r *http.Request) {
+	var req generationRequest
+	if err := readHTTPJSON(w, r, &req); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	// Catch bad requests now rather than in a failed job.
+	if _, err := s.compose(req); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	job, err := s.queue.submit(req)
+	if err != nil {
+		if warhol.CodeOf(err) == errQueueFull {
+			w.Header().Set("Retry-After", "5")
+		}
+		writeHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/generations/"+job.ID)
+	writeHTTPJSON(w, http.StatusAccepted, job)
+}
+
+func (s *server) handleGetGeneration(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.get(r.PathValue("id"))
+	if !ok {
+		writeHTTPJSON(w, http.StatusNotFound, errorDocument{Error: warhol.ErrorDetail{Code: warhol.CodeUsage, Message: "generation not found: " + r.PathValue("id")}})
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, job)
+}
+
+func (s *server) handleGenerationImage(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.get(r.PathValue("id"))
+	if !ok || job.Manifest == nil || job.Manifest.ImagePath == "" {
+		writeHTTPJSON(w, http.StatusNotFound, errorDocument{Error: warhol.ErrorDetail{Code: warhol.CodeUsage, Message: "no image for generation: " + r.PathValue("id")}})
+		return
+	}
+	http.ServeFile(w, r, job.Manifest.ImagePath)
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+type authLoginResult struct {
+	Provider    string `json:"provider"`
+	Path        string `json:"path"`
+	EnvOverride string `json:"env_override,omitempty"`
+}
+
+type authLogoutResult struct {
+	Removed []string `json:"removed"`
+}
+
+type authStatusResult struct {
+	CredentialsFile string               `json:"credentials_file"`
+	Providers       []authProviderStatus `json:"providers"`
+}
+
+type authProviderStatus struct {
+	Provider   string `json:"provider"`
+	Configured bool   `json:"configured"`
+	MaskedKey  string `json:"masked_key,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+func runAuth(args []string, out *output) int {
+	if len(args) == 0 {
+		return out.usage("missing auth subcommand (expected: login, logout, status)")
+	}
+
+	switch args[0] {
+	case "login":
+		return runAuthLogin(args[1:], out)
+	case "logout":
+		return runAuthLogout(args[1:], out)
+	case "status":
+		return runAuthStatus(args[1:], out)
+	default:
+		return out.usage("unknown auth subcommand: %s", args[0])
+	}
+}
+
+func runAuthLogin(args []string, out *output) int {
+	fs := flag.NewFlagSet("auth login", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	provider := fs.String("provider", "google", "Provider to store a key for (google|openai)")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	providerValue := strings.ToLower(*provider)
+	if !warhol.IsCredentialProvider(providerValue) {
+		return out.usage("unsupported provider %q (expected google or openai)", providerValue)
+	}
+
+	console := out.console()
+	if isInteractiveTerminal() {
+		fmt.Fprintf(console, "Enter your %s API key (input is hidden).\n", providerDisplayName(providerValue))
+	}
+	if err := promptAndStoreAPIKey(providerValue, console); err != nil {
+		return out.failf(warhol.CodeAuth, "login failed: %v", err)
+	}
+
+	result := authLoginResult{Provider: providerValue}
+	result.Path, _ = warhol.CredentialsPath()
+	for _, name := range warhol.APIKeyEnv(providerValue) {
+		if strings.TrimSpace(os.Getenv(name)) != "" {
+			out.printf("Note: %s is set and takes precedence over the stored key.\n", name)
+			result.EnvOverride = name
+			break
+		}
+	}
+	return out.result(result)
+}
+
+func runAuthLogout(args []string, out *output) int {
+	fs := flag.NewFlagSet("auth logout", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	provider := fs.String("provider", "", "Provider to remove (defaults to all)")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	providers := warhol.CredentialProviders
+	if *provider != "" {
+		providerValue := strings.ToLower(*provider)
+		if !warhol.IsCredentialProvider(providerValue) {
+			return out.usage("unsupported provider %q (expected google or openai)", providerValue)
+		}
+		providers = []string{providerValue}
+	}
+
+	result := authLogoutResult{Removed: []string{}}
+	for _, name := range providers {
+		removed, err := warhol.RemoveAPIKey(name)
+		if err != nil {
+			return out.failf(warhol.CodeAuth, "logout failed: %v", err)
+		}
+		if removed {
+			result.Removed = append(result.Removed, name)
+			out.printf("Removed stored %s API key.\n", providerDisplayName(name))
+		} else {
+			out.printf("No stored %s API key.\n", providerDisplayName(name))
+		}
+	}
+	return out.result(result)
+}
+
+func runAuthStatus(args []string, out *output) int {
+	fs := flag.NewFlagSet("auth status", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	path, err := warhol.CredentialsPath()
+	if err != nil {
+		return out.failf(warhol.CodeAuth, "failed to locate credentials file: %v", err)
+	}
+	out.printf("Credentials file: %s\n", path)
+
+	result := authStatusResult{CredentialsFile: path}
+	for _, name := range warhol.CredentialProviders {
+		key, source, err := warhol.ResolveAPIKey(name)
+		if err != nil {
+			return out.failf(warhol.CodeAuth, "failed to read credentials: %v", err)
+		}
+
+		status := authProviderStatus{Provider: name}
+		if key == "" {
+			out.printf("  %-8s not configured\n", name)
+		} else {
+			status.Configured = true
+			status.MaskedKey = maskAPIKey(key)
+			status.Source = source
+			out.printf("  %-8s %s (%s)\n", name, status.MaskedKey, source)
+		}
+		result.Providers = append(result.Providers, status)
+	}
+	return out.result(result)
+}
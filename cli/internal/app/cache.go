@@ -0,0 +1,209 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+type cacheListResult struct {
+	Dir     string              `json:"dir"`
+	Bytes   int64               `json:"bytes"`
+	Entries []warhol.CacheEntry `json:"entries"`
+}
+
+type cachePruneResult struct {
+	Dir     string   `json:"dir"`
+	Removed []string `json:"removed"`
+	Freed   int64    `json:"freed_bytes"`
+}
+
+func runCache(args []string, out *output) int {
+	if len(args) == 0 {
+		return out.usage("missing cache subcommand (expected: ls, prune, clear)")
+	}
+
+	dir, err := warhol.CacheDir()
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to resolve cache directory: %v", err)
+	}
+
+	switch args[0] {
+	case "ls":
+		return runCacheList(args[1:], dir, out)
+	case "prune":
+		return runCachePrune(args[1:], dir, out)
+	case "clear":
+		return runCacheClear(args[1:], dir, out)
+	default:
+		return out.usage("unknown cache subcommand: %s", args[0])
+	}
+}
+
+func runCacheList(args []string, dir string, out *output) int {
+	fs := flag.NewFlagSet("cache ls", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	entries, err := warhol.ListCache(dir)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read cache: %v", err)
+	}
+
+	result := cacheListResult{Dir: dir, Entries: entries}
+	for _, entry := range entries {
+		result.Bytes += entry.Bytes
+	}
+	if out.json {
+		return out.result(result)
+	}
+
+	if len(entries) == 0 {
+		out.printf("Cache is empty (%s)\n", dir)
+		return 0
+	}
+	out.printf("%-12s %-8s %-24s %9s %-20s %s\n", "KEY", "PROVIDER", "MODEL", "SIZE", "LAST_USED", "PROMPT")
+	for _, entry := range entries {
+		out.printf("%-12s %-8s %-24s %9s %-20s %s\n", shortCacheKey(entry.Key), entry.Provider, entry.Model, formatBytes(entry.Bytes), entry.LastUsedAt, truncate(entry.Prompt, 60))
+	}
+	out.printf("Total: %d, %s in %s\n", len(entries), formatBytes(result.Bytes), dir)
+	return 0
+}
+
+func runCachePrune(args []string, dir string, out *output) int {
+	fs := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	olderThan := fs.String("older-than", "30d", "Remove entries not used within this window (e.g. 30d, 12h)")
+	maxSize := fs.String("max-size", "", "Then remove least recently used entries until the cache fits (e.g. 500MB)")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	cutoff, err := parseSince(*olderThan, time.Now())
+	if err != nil {
+		return out.usage("invalid --older-than %q: %v", *olderThan, err)
+	}
+	limit := int64(-1)
+	if *maxSize != "" {
+		if limit, err = parseByteSize(*maxSize); err != nil {
+			return out.usage("invalid --max-size: %v", err)
+		}
+	}
+
+	entries, err := warhol.ListCache(dir)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read cache: %v", err)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Bytes
+	}
+
+	result := cachePruneResult{Dir: dir, Removed: []string{}}
+	// Entries are most recently used first, so walk from the end.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		lastUsed, _ := time.Parse(time.RFC3339, entry.LastUsedAt)
+		if !lastUsed.Before(cutoff) && (limit < 0 || total <= limit) {
+			continue
+		}
+		if err := warhol.RemoveCacheEntry(dir, entry.Key); err != nil {
+			return out.failf(warhol.CodeIO, "failed to remove cache entry %s: %v", entry.Key, err)
+		}
+		total -= entry.Bytes
+		result.Freed += entry.Bytes
+		result.Removed = append(result.Removed, entry.Key)
+	}
+
+	out.printf("Removed %d cache entries, freed %s\n", len(result.Removed), formatBytes(result.Freed))
+	return out.result(result)
+}
+
+func runCacheClear(args []string, dir string, out *output) int {
+	fs := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	entries, err := warhol.ListCache(dir)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read cache: %v", err)
+	}
+
+	// Only cache entries are removed, in case the directory is shared.
+	result := cachePruneResult{Dir: dir, Removed: make([]string, 0, len(entries))}
+	for _, entry := range entries {
+		if err := warhol.RemoveCacheEntry(dir, entry.Key); err != nil {
+			return out.failf(warhol.CodeIO, "failed to remove cache entry %s: %v", entry.Key, err)
+		}
+		os.Remove(filepath.Dir(entry.Path))
+		result.Removed = append(result.Removed, entry.Key)
+		result.Freed += entry.Bytes
+	}
+	out.printf("Cleared %d cache entries (%s) from %s\n", len(result.Removed), formatBytes(result.Freed), dir)
+	return out.result(result)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	if limit <= 3 {
+		return string(runes[:limit])
+	}
+	return string(runes[:limit-3]) + "..."
+}
+
+// parseByteSize parses sizes such as 500MB, 2GB or 1048576.
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if trimmed, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value = strings.TrimSpace(trimmed)
+			multiplier = unit.size
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 500MB or 2GB)", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// shortCacheKey is the prefix of a cache key shown in tables.
+func shortCacheKey(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
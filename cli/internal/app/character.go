@@ -4,39 +4,37 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
 )
 
-func runCharacter(args []string, stdout io.Writer, stderr io.Writer) int {
+func runCharacter(args []string, out *output) int {
 	if len(args) == 0 {
-		fmt.Fprintln(stderr, "missing character subcommand (expected: init)")
-		return 2
+		return out.usage("missing character subcommand (expected: init)")
 	}
 
 	switch args[0] {
 	case "init":
-		return runCharacterInit(args[1:], stdout, stderr)
+		return runCharacterInit(args[1:], out)
 	default:
-		fmt.Fprintf(stderr, "unknown character subcommand: %s\n", args[0])
-		return 2
+		return out.usage("unknown character subcommand: %s", args[0])
 	}
 }
 
-func runCharacterInit(args []string, stdout io.Writer, stderr io.Writer) int {
+func runCharacterInit(args []string, out *output) int {
 	fs := flag.NewFlagSet("character init", flag.ContinueOnError)
-	fs.SetOutput(stderr)
+	fs.SetOutput(out.stderr)
 
 	output := fs.String("output", "", "Path to output YAML file")
 	if err := fs.Parse(args); err != nil {
-		return 2
+		return out.flagError(err)
 	}
 
 	rest := fs.Args()
 	if len(rest) != 1 {
-		fmt.Fprintln(stderr, "usage: warhol character init <name> [--output <path>]")
-		return 2
+		return out.usage("usage: warhol character init <name> [--output <path>]")
 	}
 
 	name := rest[0]
@@ -46,12 +44,11 @@ func runCharacterInit(args []string, stdout io.Writer, stderr io.Writer) int {
 	}
 
 	if err := writeCharacterTemplate(path, name); err != nil {
-		fmt.Fprintf(stderr, "failed to write character template: %v\n", err)
-		return 1
+		return out.failf(warhol.CodeIO, "failed to write character template: %v", err)
 	}
 
-	fmt.Fprintf(stdout, "Created character template: %s\n", path)
-	return 0
+	out.printf("Created character template: %s\n", path)
+	return out.result(profileInitResult{Kind: "character", Name: name, Path: path})
 }
 
 func writeCharacterTemplate(path string, characterName string) error {
@@ -2,48 +2,120 @@ package app
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"strings"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
 )
 
-func ensureGoogleAPIKey(stdout io.Writer, stderr io.Writer) error {
-	if strings.TrimSpace(os.Getenv("GEMINI_API_KEY")) != "" || strings.TrimSpace(os.Getenv("GOOGLE_API_KEY")) != "" {
+// ensureAPIKey makes sure provider has a key, asking for one only when
+// interactive is set and stdin is a terminal. Otherwise a missing key is
+// an error.
+func ensureAPIKey(provider string, interactive bool, stdout io.Writer) error {
+	if !warhol.IsCredentialProvider(provider) {
 		return nil
 	}
 
-	if !isInteractiveTerminal() {
-		return fmt.Errorf("GEMINI_API_KEY (or GOOGLE_API_KEY) is required")
+	key, _, err := warhol.ResolveAPIKey(provider)
+	if err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+	if key != "" {
+		return nil
 	}
 
-	fmt.Fprintln(stdout, "Hello! Please enter your Google API key.")
-	fmt.Fprint(stdout, "GEMINI_API_KEY: ")
+	if !interactive || !isInteractiveTerminal() {
+		_, err := warhol.RequireAPIKey(provider)
+		return err
+	}
 
-	reader := bufio.NewReader(os.Stdin)
-	value, err := reader.ReadString('\n')
+	fmt.Fprintf(stdout, "Hello! Please enter your %s API key.\n", providerDisplayName(provider))
+	if err := promptAndStoreAPIKey(provider, stdout); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "Tip: run `warhol auth status` to see which keys are configured.")
+	return nil
+}
+
+func promptAndStoreAPIKey(provider string, stdout io.Writer) error {
+	if isInteractiveTerminal() {
+		fmt.Fprintf(stdout, "%s: ", warhol.APIKeyEnv(provider)[0])
+	}
+
+	value, err := readSecret(os.Stdin, stdout)
 	if err != nil {
 		return fmt.Errorf("failed to read API key: %w", err)
 	}
-
-	value = strings.TrimSpace(value)
 	if value == "" {
 		return fmt.Errorf("empty API key provided")
 	}
 
-	if err := os.Setenv("GEMINI_API_KEY", value); err != nil {
-		return fmt.Errorf("failed to set API key: %w", err)
+	if err := warhol.StoreAPIKey(provider, value); err != nil {
+		return fmt.Errorf("failed to store API key: %w", err)
 	}
 
-	fmt.Fprintln(stdout, "API key set for this session.")
-	fmt.Fprintln(stdout, "Tip: export GEMINI_API_KEY in your shell profile to skip this prompt.")
+	path, _ := warhol.CredentialsPath()
+	fmt.Fprintf(stdout, "API key saved to %s\n", path)
 	return nil
 }
 
-func isInteractiveTerminal() bool {
-	info, err := os.Stdin.Stat()
-	if err != nil {
-		return false
+// readSecret reads one line from in. When in is a terminal, echo is
+// switched off for the duration of the read.
+func readSecret(in *os.File, stdout io.Writer) (string, error) {
+	if isTerminal(in) {
+		if restore := disableEcho(in); restore != nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(stdout)
+			}()
+		}
+	}
+
+	reader := bufio.NewReader(in)
+	value, err := reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && value != "") {
+		return "", err
 	}
-	return (info.Mode() & os.ModeCharDevice) != 0
+	return strings.TrimSpace(value), nil
+}
+
+func disableEcho(in *os.File) func() {
+	cmd := exec.Command("stty", "-echo")
+	cmd.Stdin = in
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+
+	return func() {
+		cmd := exec.Command("stty", "echo")
+		cmd.Stdin = in
+		_ = cmd.Run()
+	}
+}
+
+func maskAPIKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", 4) + key[len(key)-4:]
+}
+
+func providerDisplayName(provider string) string {
+	switch provider {
+	case "google":
+		return "Google"
+	case "openai":
+		return "OpenAI"
+	default:
+		return provider
+	}
+}
+
+func isInteractiveTerminal() bool {
+	return isTerminal(os.Stdin)
 }
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+type doctorStatus string
+
+const (
+	doctorPass doctorStatus = "PASS"
+	doctorWarn doctorStatus = "WARN"
+	doctorFail doctorStatus = "FAIL"
+)
+
+type doctorCheck struct {
+	Name   string       `json:"name"`
+	Status doctorStatus `json:"status"`
+	Detail string       `json:"detail"`
+}
+
+type doctorResult struct {
+	OK     bool          `json:"ok"`
+	Failed int           `json:"failed"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+func runDoctor(args []string, out *output) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Output directory to check")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for base URL reachability checks")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	client := warhol.NewClient(warhol.Options{})
+	checks := make([]doctorCheck, 0, 16)
+	checks = append(checks, checkConfigRoots(client)...)
+	// A broken config is reported by checkConfigRoots.
+	cfg, _, _ := warhol.LoadConfig(defaultProjectPath("."))
+	checks = append(checks, checkProviderKeys(cfg)...)
+	checks = append(checks, checkBaseURLs(*timeout)...)
+	checks = append(checks, checkOutputDir(*outDir))
+	checks = append(checks, checkProfiles(client, "styles")...)
+	checks = append(checks, checkProfiles(client, "characters")...)
+	checks = append(checks, checkQueueProviders(client)...)
+
+	result := doctorResult{Checks: checks}
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			result.Failed++
+		}
+	}
+	result.OK = result.Failed == 0
+
+	if out.json {
+		if code := out.result(result); code != 0 {
+			return code
+		}
+	} else {
+		printDoctorTable(out.stdout, checks)
+	}
+
+	if !result.OK {
+		fmt.Fprintf(out.stderr, "%d check(s) failed\n", result.Failed)
+		return 1
+	}
+	return 0
+}
+
+func printDoctorTable(w io.Writer, checks []doctorCheck) {
+	width := len("CHECK")
+	for _, check := range checks {
+		width = max(width, len(check.Name))
+	}
+
+	fmt.Fprintf(w, "%-6s %-*s %s\n", "STATUS", width, "CHECK", "DETAIL")
+	for _, check := range checks {
+		fmt.Fprintf(w, "%-6s %-*s %s\n", check.Status, width, check.Name, check.Detail)
+	}
+}
+
+func checkConfigRoots(client *warhol.Client) []doctorCheck {
+	checks := make([]doctorCheck, 0, 2)
+
+	dir, err := warhol.ConfigDir()
+	switch {
+	case err != nil:
+		checks = append(checks, doctorCheck{"config dir", doctorFail, err.Error()})
+	case dirExists(dir):
+		checks = append(checks, doctorCheck{"config dir", doctorPass, dir})
+	default:
+		checks = append(checks, doctorCheck{"config dir", doctorWarn, dir + " (not created yet)"})
+	}
+
+	path, err := warhol.CredentialsPath()
+	if err == nil {
+		if info, statErr := os.Stat(path); statErr == nil {
+			if info.Mode().Perm()&0o077 != 0 {
+				checks = append(checks, doctorCheck{"credentials file", doctorWarn, fmt.Sprintf("%s has mode %v (expected 0600)", path, info.Mode().Perm())})
+			} else {
+				checks = append(checks, doctorCheck{"credentials file", doctorPass, path})
+			}
+		} else if errors.Is(statErr, os.ErrNotExist) {
+			checks = append(checks, doctorCheck{"credentials file", doctorWarn, path + " (not found)"})
+		} else {
+			checks = append(checks, doctorCheck{"credentials file", doctorFail, statErr.Error()})
+		}
+	}
+
+	if _, loaded, err := warhol.LoadConfig(defaultProjectPath(".")); err != nil {
+		checks = append(checks, doctorCheck{"config file", doctorFail, err.Error()})
+	} else if len(loaded) == 0 {
+		checks = append(checks, doctorCheck{"config file", doctorPass, "none found (looked for " + strings.Join(warhol.ConfigPaths(defaultProjectPath(".")), ", ") + ")"})
+	} else {
+		checks = append(checks, doctorCheck{"config file", doctorPass, strings.Join(loaded, ", ")})
+	}
+
+	for _, kind := range []string{"styles", "characters"} {
+		dirs := client.ProfileDirs(kind)
+		if len(dirs) == 0 {
+			checks = append(checks, doctorCheck{kind + " root", doctorFail, fmt.Sprintf("no %s/ directory found in . or ..", kind)})
+			continue
+		}
+		checks = append(checks, doctorCheck{kind + " root", doctorPass, strings.Join(dirs, ", ")})
+	}
+
+	return checks
+}
+
+// checkProviderKeys fails for a missing key only when generate would use
+// the provider: google by default, and the providers of the config's
+// fallback chain. Other providers without a key are a warning.
+func checkProviderKeys(cfg warhol.Config) []doctorCheck {
+	used := map[string]string{"google": "the default provider"}
+	for _, entry := range cfg.Fallback {
+		provider, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), ":")
+		if _, ok := used[provider]; !ok {
+			used[provider] = "in the config's fallback chain"
+		}
+	}
+
+	checks := make([]doctorCheck, 0, len(warhol.CredentialProviders))
+	for _, provider := range warhol.CredentialProviders {
+		name := provider + " key"
+		key, source, err := warhol.ResolveAPIKey(provider)
+		switch {
+		case err != nil:
+			checks = append(checks, doctorCheck{name, doctorFail, err.Error()})
+		case key != "":
+			checks = append(checks, doctorCheck{name, doctorPass, fmt.Sprintf("%s (%s)", maskAPIKey(key), source)})
+		case used[provider] != "":
+			checks = append(checks, doctorCheck{name, doctorFail, fmt.Sprintf("not configured, but %s is %s; run `warhol auth login --provider %s`", provider, used[provider], provider)})
+		default:
+			checks = append(checks, doctorCheck{name, doctorWarn, "not configured"})
+		}
+	}
+	return checks
+}
+
+func checkBaseURLs(timeout time.Duration) []doctorCheck {
+	overrides := []struct {
+		env      string
+		provider string
+	}{
+		{"GEMINI_BASE_URL", "google"},
+		{"OPENAI_BASE_URL", "openai"},
+		{"SD_BASE_URL", "sd"},
+		{"COMFYUI_BASE_URL", "comfyui"},
+	}
+
+	client := &http.Client{Timeout: timeout}
+	checks := make([]doctorCheck, 0, len(overrides))
+	for _, override := range overrides {
+		value := strings.TrimSpace(os.Getenv(override.env))
+		if value == "" {
+			checks = append(checks, doctorCheck{override.env, doctorPass, "not set (using " + warhol.DefaultBaseURL(override.provider) + ")"})
+			continue
+		}
+
+		resp, err := client.Get(value)
+		if err != nil {
+			checks = append(checks, doctorCheck{override.env, doctorFail, fmt.Sprintf("%s unreachable: %v", value, err)})
+			continue
+		}
+		resp.Body.Close()
+		checks = append(checks, doctorCheck{override.env, doctorPass, fmt.Sprintf("%s reachable (status %d)", value, resp.StatusCode)})
+	}
+	return checks
+}
+
+// checkOutputDir checks that dir, or the nearest existing parent that
+// generate would create it in, is a writable directory. Only a probe file
+// is written, and removed again.
+func checkOutputDir(dir string) doctorCheck {
+	existing := dir
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return doctorCheck{"output dir", doctorFail, existing + " is not a directory"}
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return doctorCheck{"output dir", doctorFail, err.Error()}
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return doctorCheck{"output dir", doctorFail, err.Error()}
+		}
+		existing = parent
+	}
+
+	probe, err := os.CreateTemp(existing, ".warhol-doctor-*")
+	if err != nil {
+		return doctorCheck{"output dir", doctorFail, fmt.Sprintf("%s not writable: %v", existing, err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if existing != dir {
+		return doctorCheck{"output dir", doctorPass, abs + " can be created"}
+	}
+	return doctorCheck{"output dir", doctorPass, abs + " writable"}
+}
+
+func checkProfiles(client *warhol.Client, kind string) []doctorCheck {
+	list := client.ListStyles
+	if kind == "characters" {
+		list = client.ListCharacters
+	}
+	profiles, err := list()
+	if err != nil {
+		return []doctorCheck{{kind, doctorFail, err.Error()}}
+	}
+	if len(profiles) == 0 {
+		return []doctorCheck{{kind, doctorWarn, "no profiles found"}}
+	}
+
+	checks := make([]doctorCheck, 0, len(profiles))
+	for _, profile := range profiles {
+		name := strings.TrimSuffix(kind, "s") + " " + profile.Name
+		err := profile.Error
+		if err == "" && kind == "styles" {
+			err = checkStyleReferences(client, profile.Path)
+		}
+		if err != "" {
+			checks = append(checks, doctorCheck{name, doctorFail, err})
+			continue
+		}
+		checks = append(checks, doctorCheck{name, doctorPass, profile.Path})
+	}
+	return checks
+}
+
+// checkStyleReferences returns a message for the first missing reference
+// image of the style at path, or "".
+func checkStyleReferences(client *warhol.Client, path string) string {
+	style, stylePath, err := client.LoadStyle(path)
+	if err != nil {
+		return err.Error()
+	}
+	for _, ref := range style.ReferencePaths(stylePath) {
+		if _, err := os.Stat(ref); err != nil {
+			return fmt.Sprintf("reference image %s: %v", ref, err)
+		}
+	}
+	return ""
+}
+
+func checkQueueProviders(client *warhol.Client) []doctorCheck {
+	providers, err := client.ListProviders()
+	if err != nil {
+		return []doctorCheck{{"providers", doctorFail, err.Error()}}
+	}
+
+	checks := make([]doctorCheck, 0, len(providers))
+	for _, provider := range providers {
+		name := "provider " + provider.Name
+		switch {
+		case provider.Error != "":
+			checks = append(checks, doctorCheck{name, doctorFail, provider.Error})
+		case provider.Warning != "":
+			checks = append(checks, doctorCheck{name, doctorWarn, provider.Warning})
+		default:
+			checks = append(checks, doctorCheck{name, doctorPass, provider.Path})
+		}
+	}
+	return checks
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"image/jpeg"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/internal/imaging"
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+//go:embed assets/gallery.html
+var galleryHTML string
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(galleryHTML))
+
+// galleryItem is one generated image as seen by the gallery page.
+type galleryItem struct {
+	ID        string          `json:"id"`
+	CreatedAt string          `json:"created_at"`
+	Date      string          `json:"date"`
+	Style     string          `json:"style"`
+	Character string          `json:"character"`
+	Provider  string          `json:"provider"`
+	Model     string          `json:"model"`
+	Status    string          `json:"status"`
+	Prompt    string          `json:"prompt"`
+	Score     *float64        `json:"score,omitempty"`
+	Thumb     string          `json:"thumb"`
+	Image     string          `json:"image"`
+	Manifest  json.RawMessage `json:"manifest"`
+}
+
+type galleryPage struct {
+	Title       string
+	GeneratedAt string
+	Items       []galleryItem
+}
+
+type galleryResult struct {
+	Path    string `json:"path"`
+	OutDir  string `json:"out_dir"`
+	Images  int    `json:"images"`
+	Skipped int    `json:"skipped"`
+}
+
+func runGallery(args []string, out *output) int {
+	fs := flag.NewFlagSet("gallery", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Directory containing generated artifacts")
+	outputPath := fs.String("output", "", "Path of the HTML file (default: <out-dir>/gallery.html)")
+	thumb := fs.Int("thumb", 320, "Thumbnail size in pixels")
+	title := fs.String("title", "warhol gallery", "Page title")
+	embedImages := fs.Bool("embed", false, "Embed full-size images so the page works without the output directory")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+	if fs.NArg() > 0 {
+		return out.usage("usage: warhol gallery [--out-dir <dir>] [--output <path>] [--thumb <px>] [--title <text>] [--embed]")
+	}
+	if *thumb < 64 {
+		return out.usage("--thumb must be at least 64")
+	}
+
+	path := *outputPath
+	if path == "" {
+		path = filepath.Join(*outDir, "gallery.html")
+	}
+
+	manifests, err := warhol.LoadManifests(*outDir)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read manifests: %v", err)
+	}
+
+	page := galleryPage{Title: *title, GeneratedAt: time.Now().UTC().Format(time.RFC3339), Items: make([]galleryItem, 0, len(manifests))}
+	result := galleryResult{Path: path, OutDir: *outDir}
+	// Newest first, the order people browse history in.
+	for i := len(manifests) - 1; i >= 0; i-- {
+		stored := manifests[i]
+		if stored.ImageFile() == "" {
+			continue
+		}
+		item, err := galleryItemFor(stored, path, *thumb, *embedImages)
+		if err != nil {
+			out.logger.Warn("skipping image", "manifest", stored.Path, "error", err)
+			result.Skipped++
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+	result.Images = len(page.Items)
+
+	var buf bytes.Buffer
+	if err := galleryTemplate.Execute(&buf, page); err != nil {
+		return out.fail(warhol.WithCode(warhol.CodeInternal, fmt.Errorf("render gallery: %w", err)))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return out.failf(warhol.CodeIO, "failed to write gallery: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return out.failf(warhol.CodeIO, "failed to write gallery: %v", err)
+	}
+
+	out.printf("Gallery saved: %s (%d image(s))\n", path, result.Images)
+	if result.Skipped > 0 {
+		out.printf("Skipped %d image(s) that could not be read\n", result.Skipped)
+	}
+	return out.result(result)
+}
+
+func galleryItemFor(stored warhol.StoredManifest, pagePath string, thumbSize int, embedImages bool) (galleryItem, error) {
+	manifest := stored.Manifest
+	imagePath := stored.ImageFile()
+	raw, err := os.ReadFile(stored.Path)
+	if err != nil {
+		return galleryItem{}, err
+	}
+
+	img, err := imaging.DecodeFile(imagePath)
+	if err != nil {
+		return galleryItem{}, err
+	}
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, imaging.Fit(img, thumbSize, thumbSize), &jpeg.Options{Quality: 80}); err != nil {
+		return galleryItem{}, err
+	}
+
+	item := galleryItem{
+		ID:        strings.TrimSuffix(filepath.Base(stored.Path), ".json"),
+		CreatedAt: manifest.CreatedAt,
+		Style:     manifest.StyleName(),
+		Character: manifest.CharacterName(),
+		Provider:  manifest.Provider,
+		Model:     manifest.Model,
+		Status:    manifest.Status,
+		Prompt:    manifest.Prompt,
+		Thumb:     "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumb.Bytes()),
+		Manifest:  json.RawMessage(raw),
+	}
+	if created := manifest.Time(); !created.IsZero() {
+		item.Date = created.Local().Format("2006-01-02")
+	}
+	if manifest.Score != nil {
+		item.Score = &manifest.Score.Score
+	}
+
+	if embedImages {
+		data, err := os.ReadFile(imagePath)
+		if err != nil {
+			return galleryItem{}, err
+		}
+		mediaType := mime.TypeByExtension(filepath.Ext(imagePath))
+		if mediaType == "" {
+			mediaType = "image/png"
+		}
+		item.Image = "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+		return item, nil
+	}
+
+	item.Image, err = relativeURL(filepath.Dir(pagePath), imagePath)
+	if err != nil {
+		return galleryItem{}, err
+	}
+	return item, nil
+}
+
+// relativeURL is target as a URL path relative to the directory base.
+func relativeURL(base string, target string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absBase, absTarget)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String(), nil
+}
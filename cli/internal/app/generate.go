@@ -1,198 +1,240 @@
 package app
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
-)
 
-type generationManifest struct {
-	CreatedAt     string `json:"created_at"`
-	Provider      string `json:"provider"`
-	Model         string `json:"model"`
-	Size          string `json:"size,omitempty"`
-	Quality       string `json:"quality,omitempty"`
-	StyleInput    string `json:"style_input"`
-	StyleFile     string `json:"style_file"`
-	Character     string `json:"character,omitempty"`
-	CharacterFile string `json:"character_file,omitempty"`
-	Prompt        string `json:"prompt"`
-	FinalPrompt   string `json:"final_prompt"`
-	ImagePath     string `json:"image_path,omitempty"`
-	DryRun        bool   `json:"dry_run"`
-}
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
 
-func runGenerate(args []string, stdout io.Writer, stderr io.Writer) int {
+func runGenerate(args []string, out *output) int {
 	args = normalizeGenerateArgs(args)
 
 	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
-	fs.SetOutput(stderr)
+	fs.SetOutput(out.stderr)
 
 	style := fs.String("style", "", "Style profile path or name")
 	character := fs.String("character", "", "Character profile path or name")
 	prompt := fs.String("prompt", "", "Prompt text")
+	location := fs.String("location", "", "Where the scene takes place")
 	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Directory for generated artifacts")
-	provider := fs.String("provider", "google", "Image provider (google|openai)")
+	provider := fs.String("provider", "google", "Image provider (google|openai|sd|comfyui), or a comma-separated fallback chain")
 	model := fs.String("model", "", "Model override (defaults by provider)")
-	size := fs.String("size", "1024x1024", "OpenAI image size (e.g. 1024x1024)")
+	size := fs.String("size", "", "Image size as WIDTHxHEIGHT (mapped to each provider)")
+	aspect := fs.String("aspect", "", "Aspect ratio as W:H, e.g. 16:9 (mapped to each provider)")
 	quality := fs.String("quality", "medium", "OpenAI image quality (e.g. low, medium, high)")
 	dryRun := fs.Bool("dry-run", false, "Compose prompt and write metadata without generating image")
+	count := fs.Int("count", 1, "Number of images to generate")
+	combinations := fs.Bool("combinations", false, "Generate every combination of the prompt's wildcards")
+	sample := fs.Int("sample", 1, "Number of random expansions of the prompt's wildcards")
+	wildcardSeed := fs.Int64("wildcard-seed", 0, "Seed for --sample (default random; recorded in the manifest)")
+	score := fs.Bool("score", false, "Score the image against the style's reference images")
+	minScore := fs.Float64("min-score", 0, "Score images and regenerate those below this (default: the style's score_threshold with --score)")
+	maxRejects := fs.Int("max-rejects", 2, "How many rejected images to regenerate before failing")
+	useCache := fs.Bool("cache", false, "Reuse a cached image for an identical request, and cache new images")
+	concurrency := fs.Int("concurrency", 1, "Number of images generated in parallel with --count")
+	ignoreBudget := fs.Bool("ignore-budget", false, "Generate even when a configured budget is exhausted")
+	var refs stringList
+	fs.Var(&refs, "ref", "Reference image path (repeatable; sd uses img2img)")
+	vars := varMap{}
+	fs.Var(vars, "var", "Template variable as key=value for the style's prompt_template (repeatable)")
 
 	if err := fs.Parse(args); err != nil {
-		return 2
+		return out.flagError(err)
 	}
-	if *style == "" || *prompt == "" {
-		fmt.Fprintln(stderr, "usage: warhol generate --style <path-or-name> [--character <name-or-path>|-<name>] --prompt <text> [--provider google|openai] [--model <name>] [--out-dir <dir>]")
-		return 2
+	if *count < 1 {
+		return out.usage("--count must be at least 1")
 	}
-
-	ts := time.Now().UTC().Format("20060102-150405")
-	if err := os.MkdirAll(*outDir, 0o755); err != nil {
-		fmt.Fprintf(stderr, "failed to create output directory: %v\n", err)
-		return 1
+	if *concurrency < 1 {
+		return out.usage("--concurrency must be at least 1")
+	}
+	if *sample < 1 {
+		return out.usage("--sample must be at least 1")
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if *combinations && set["sample"] {
+		return out.usage("--combinations and --sample cannot be used together")
+	}
+	if *minScore < 0 || *minScore > 1 {
+		return out.usage("--min-score must be between 0 and 1")
+	}
+	if *maxRejects < 0 {
+		return out.usage("--max-rejects must not be negative")
+	}
+	if *style == "" || *prompt == "" {
+		return out.usage("usage: warhol generate --style <path-or-name> [--character <name-or-path>|-<name>] --prompt <text> [--provider google|openai|sd|comfyui] [--ref <image>] [--aspect <W:H>] [--size <WxH>] [--model <name>] [--out-dir <dir>]")
 	}
 
-	styleProfile, stylePath, err := loadStyleProfile(*style)
+	cfg, _, err := warhol.LoadConfig(defaultProjectPath("."))
 	if err != nil {
-		fmt.Fprintf(stderr, "failed to load style profile: %v\n", err)
-		return 1
+		return out.failf(warhol.CodeUsage, "failed to load config: %v", err)
 	}
 
-	var characterProfileData *characterProfile
-	characterPath := ""
-	if *character != "" {
-		loadedCharacter, resolvedPath, err := loadCharacterProfile(*character)
-		if err != nil {
-			fmt.Fprintf(stderr, "failed to load character profile: %v\n", err)
-			return 1
-		}
-		characterProfileData = &loadedCharacter
-		characterPath = resolvedPath
+	client := warhol.NewClient(warhol.Options{OutDir: *outDir, Config: cfg, Logger: out.logger, IgnoreBudget: *ignoreBudget})
+	req := warhol.Request{
+		Style:      *style,
+		Character:  *character,
+		Prompt:     *prompt,
+		Location:   *location,
+		Vars:       vars,
+		Provider:   *provider,
+		Model:      *model,
+		Size:       *size,
+		Aspect:     *aspect,
+		Quality:    *quality,
+		DryRun:     *dryRun,
+		Refs:       refs,
+		Cache:      *useCache,
+		Score:      *score,
+		MinScore:   *minScore,
+		MaxRejects: *maxRejects,
 	}
 
-	finalPrompt := buildFinalPrompt(styleProfile, characterProfileData, *prompt)
-	providerValue := strings.ToLower(*provider)
-
-	resolvedModel, err := resolveModel(providerValue, *model)
-	if err != nil {
-		fmt.Fprintf(stderr, "invalid model/provider: %v\n", err)
-		return 2
+	expandOpts := warhol.ExpandOptions{All: *combinations, Sample: *sample}
+	if set["wildcard-seed"] {
+		expandOpts.Seed = wildcardSeed
 	}
-
-	manifest := generationManifest{
-		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
-		Provider:      providerValue,
-		Model:         resolvedModel,
-		StyleInput:    *style,
-		StyleFile:     stylePath,
-		Prompt:        *prompt,
-		FinalPrompt:   finalPrompt,
-		DryRun:        *dryRun,
-		Character:     *character,
-		CharacterFile: characterPath,
+	reqs, err := client.Expand(req, expandOpts)
+	if err != nil {
+		return out.fail(err)
 	}
-	if providerValue == "openai" {
-		manifest.Size = *size
-		manifest.Quality = *quality
+	wildcards := reqs[0].Wildcards
+	if wildcards == nil && (*combinations || set["sample"] || set["wildcard-seed"]) {
+		return out.usage("--combinations, --sample and --wildcard-seed need a prompt with {a|b} or __name__ wildcards")
 	}
 
-	imagePath := filepath.Join(*outDir, "image-"+ts+".png")
+	composed, err := client.Compose(reqs[0])
+	if err != nil {
+		return out.fail(err)
+	}
 	if !*dryRun {
-		if providerValue == "google" {
-			if err := ensureGoogleAPIKey(stdout, stderr); err != nil {
-				fmt.Fprintf(stderr, "failed to configure Google API key: %v\n", err)
-				return 1
-			}
+		// JSON output is for scripts, so never stop to prompt.
+		if err := ensureAPIKey(composed.Provider, !out.json, out.console()); err != nil {
+			return out.failf(warhol.CodeAuth, "failed to configure %s API key: %v", providerDisplayName(composed.Provider), err)
 		}
+	}
 
-		imageBytes, err := generateImage(providerValue, resolvedModel, finalPrompt, *size, *quality)
-		if err != nil {
-			fmt.Fprintf(stderr, "image generation failed: %v\n", err)
-			return 1
+	if wildcards != nil {
+		if wildcards.Seed != nil {
+			out.printf("Wildcards: %d sample(s), seed %d\n", len(reqs), *wildcards.Seed)
+		} else {
+			out.printf("Wildcards: %d combination(s)\n", len(reqs))
 		}
+	}
 
-		if err := os.WriteFile(imagePath, imageBytes, 0o644); err != nil {
-			fmt.Fprintf(stderr, "failed to write image: %v\n", err)
-			return 1
+	ctx := context.Background()
+	total := len(reqs) * *count
+	if total == 1 {
+		result, err := client.Generate(ctx, reqs[0])
+		if err != nil {
+			detail := warhol.Describe(err)
+			detail.ManifestPath = result.ManifestPath
+			return out.failDetail(detail)
 		}
-
-		manifest.ImagePath = imagePath
+		printGenerateResult(out, result)
+		return out.result(result)
 	}
 
-	data, err := json.MarshalIndent(manifest, "", "  ")
+	batch, err := runGenerateBatch(ctx, out, client, reqs, *count, *concurrency)
 	if err != nil {
-		fmt.Fprintf(stderr, "failed to encode manifest: %v\n", err)
-		return 1
+		return out.fail(err)
 	}
-
-	manifestPath := filepath.Join(*outDir, "manifest-"+ts+".json")
-	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
-		fmt.Fprintf(stderr, "failed to write metadata: %v\n", err)
-		return 1
+	if code := out.result(batch); code != 0 {
+		return code
 	}
-
-	fmt.Fprintf(stdout, "Prompt: %s\n", finalPrompt)
-	if *dryRun {
-		fmt.Fprintln(stdout, "Dry run: image generation skipped.")
-	} else {
-		fmt.Fprintf(stdout, "Image saved: %s\n", imagePath)
+	if batch.Failed > 0 {
+		fmt.Fprintf(out.stderr, "%d of %d generation(s) failed\n", batch.Failed, total)
+		return 1
 	}
-	fmt.Fprintf(stdout, "Manifest saved: %s\n", manifestPath)
 	return 0
 }
 
-func resolveModel(provider string, override string) (string, error) {
-	if override != "" {
-		return override, nil
+// runGenerateBatch generates count images for each of reqs on up to
+// concurrency workers, reporting each result as it finishes.
+func runGenerateBatch(ctx context.Context, out *output, client *warhol.Client, reqs []warhol.Request, count int, concurrency int) (warhol.BatchResult, error) {
+	var succeeded int
+	var total float64
+	images := len(reqs) * count
+	batch, err := client.GenerateAll(ctx, reqs, warhol.BatchOptions{
+		Count:       count,
+		Concurrency: concurrency,
+		OnResult: func(i int, result warhol.Result, err error) {
+			if err != nil {
+				fmt.Fprintf(out.stderr, "[%d/%d] %s\n", i+1, images, warhol.Describe(err).Message)
+				return
+			}
+			succeeded++
+			if usage := result.Manifest.Usage; usage != nil {
+				total = warhol.RoundCost(total + usage.EstimatedCostUSD)
+			}
+			out.printf("[%d/%d]\n", i+1, images)
+			printGenerateResult(out, result)
+			out.printf("Run total: $%.4f for %d image(s)\n", total, succeeded)
+		},
+	})
+	if err != nil {
+		return batch, err
 	}
-
-	switch provider {
-	case "google":
-		return "gemini-2.5-flash-image", nil
-	case "openai":
-		return "gpt-image-1", nil
-	default:
-		return "", fmt.Errorf("unsupported provider %q (expected google or openai)", provider)
+	if batch.RateLimitWaitMS > 0 {
+		out.printf("Rate limit wait: %s\n", time.Duration(batch.RateLimitWaitMS)*time.Millisecond)
 	}
+	return batch, nil
 }
 
-func generateImage(provider string, model string, prompt string, size string, quality string) ([]byte, error) {
-	switch provider {
-	case "google":
-		client, err := newGoogleClient()
-		if err != nil {
-			return nil, err
-		}
-		return client.generateImage(model, prompt)
-	case "openai":
-		client, err := newOpenAIClient()
-		if err != nil {
-			return nil, err
-		}
-		return client.generateImage(model, prompt, size, quality)
-	default:
-		return nil, fmt.Errorf("unsupported provider %q (expected google or openai)", provider)
+func printGenerateResult(out *output, result warhol.Result) {
+	out.printf("Prompt: %s\n", result.Manifest.FinalPrompt)
+	if attempts := len(result.Manifest.Attempts); attempts > 1 {
+		out.printf("Provider: %s (%s) after %d attempts\n", result.Manifest.Provider, result.Manifest.Model, attempts)
+	}
+	if result.Manifest.DryRun {
+		out.println("Dry run: image generation skipped.")
+	} else {
+		out.printf("Image saved: %s\n", result.ImagePath)
+	}
+	if score := result.Manifest.Score; score != nil {
+		out.printf("Style score: %.3f\n", score.Score)
+	}
+	if cache := result.Manifest.Cache; cache != nil && cache.Hit {
+		out.printf("Cache hit: %s\n", shortCacheKey(cache.Key))
 	}
+	if usage := result.Manifest.Usage; usage != nil {
+		out.printf("Estimated cost: $%.4f (%s)\n", usage.EstimatedCostUSD, usage.CostBasis)
+	}
+	out.printf("Manifest saved: %s\n", result.ManifestPath)
 }
 
 func normalizeGenerateArgs(args []string) []string {
 	known := map[string]struct{}{
-		"style":     {},
-		"character": {},
-		"prompt":    {},
-		"out-dir":   {},
-		"provider":  {},
-		"model":     {},
-		"size":      {},
-		"quality":   {},
-		"dry-run":   {},
-		"h":         {},
-		"help":      {},
+		"style":         {},
+		"character":     {},
+		"prompt":        {},
+		"location":      {},
+		"var":           {},
+		"out-dir":       {},
+		"provider":      {},
+		"model":         {},
+		"size":          {},
+		"aspect":        {},
+		"quality":       {},
+		"dry-run":       {},
+		"count":         {},
+		"combinations":  {},
+		"sample":        {},
+		"wildcard-seed": {},
+		"ignore-budget": {},
+		"concurrency":   {},
+		"cache":         {},
+		"score":         {},
+		"min-score":     {},
+		"max-rejects":   {},
+		"ref":           {},
+		"h":             {},
+		"help":          {},
 	}
 
 	normalized := make([]string, 0, len(args)+2)
@@ -223,3 +265,40 @@ func normalizeGenerateArgs(args []string) []string {
 
 	return normalized
 }
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// varMap collects repeated key=value flags. A later value for the same key
+// wins.
+type varMap map[string]string
+
+func (m varMap) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+m[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m varMap) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("want key=value, got %q", value)
+	}
+	m[strings.TrimSpace(key)] = val
+	return nil
+}
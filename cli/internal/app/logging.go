@@ -0,0 +1,18 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+)
+
+func newLogger(w io.Writer, verbose bool, jsonFormat bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelWarn}
+	if verbose {
+		opts.Level = slog.LevelDebug
+	}
+
+	if jsonFormat {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
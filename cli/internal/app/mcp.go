@@ -0,0 +1,472 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+// MCP protocol revisions warhol can speak, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpRecentManifests is how many manifests are listed as resources.
+const mcpRecentManifests = 20
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// mcpServer serves warhol tools and resources to an MCP client over
+// newline-delimited JSON-RPC on stdin and stdout. Generation shares the
+// HTTP server's code path.
+type mcpServer struct {
+	*server
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+func runMCP(args []string, out *output) int {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Directory for generated artifacts")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+	if fs.NArg() > 0 {
+		return out.usage("usage: warhol mcp [--out-dir <dir>]")
+	}
+
+	cfg, _, err := warhol.LoadConfig(defaultProjectPath("."))
+	if err != nil {
+		return out.failf(warhol.CodeUsage, "failed to load config: %v", err)
+	}
+
+	s := &mcpServer{
+		server:   newServer(out.logger, *outDir, cfg),
+		w:        out.stdout,
+		inflight: make(map[string]context.CancelFunc),
+	}
+	if err := s.serve(context.Background(), os.Stdin); err != nil {
+		out.logger.Error("mcp server stopped", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// serve reads messages until in is closed. Requests run concurrently so a
+// slow generation does not block pings or listings.
+func (s *mcpServer) serve(ctx context.Context, in io.Reader) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+		if msg.Method == "" {
+			// Responses to server requests; warhol sends none.
+			continue
+		}
+		if len(msg.ID) == 0 {
+			s.notify(msg)
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.inflight[string(msg.ID)] = cancel
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.inflight, string(msg.ID))
+				s.mu.Unlock()
+				cancel()
+			}()
+
+			result, err := s.handle(reqCtx, msg)
+			response := rpcMessage{ID: msg.ID, Result: result}
+			if err != nil {
+				var rpcErr *rpcError
+				if !errors.As(err, &rpcErr) {
+					rpcErr = &rpcError{Code: rpcInvalidRequest, Message: err.Error()}
+				}
+				response = rpcMessage{ID: msg.ID, Error: rpcErr}
+			}
+			s.send(response)
+		}()
+	}
+	return scanner.Err()
+}
+
+func (s *mcpServer) send(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("failed to encode mcp message", "error", err)
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.w.Write(append(data, '\n'))
+}
+
+func (s *mcpServer) notify(msg rpcMessage) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.inflight[string(params.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *mcpServer) handle(ctx context.Context, msg rpcMessage) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		protocol := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			protocol = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": protocol,
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "warhol", "version": version},
+			"instructions":    "Generate on-brand images with the project's warhol style and character profiles. List styles and characters first, preview with compose_prompt, then call generate_image.",
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, params.Name, params.Arguments)
+	case "resources/list":
+		return s.listResources()
+	case "resources/templates/list":
+		return map[string]any{"resourceTemplates": []map[string]string{
+			{"uriTemplate": "warhol://styles/{name}", "name": "Style profile", "mimeType": "application/yaml"},
+			{"uriTemplate": "warhol://characters/{name}", "name": "Character profile", "mimeType": "application/yaml"},
+			{"uriTemplate": "warhol://manifests/{id}", "name": "Generation manifest", "mimeType": "application/json"},
+		}}, nil
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.readResource(params.URI)
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// mcpTool is a tool definition as listed by tools/list.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+var (
+	mcpEmptySchema = map[string]any{"type": "object", "properties": map[string]any{}}
+
+	mcpComposeProperties = map[string]any{
+		"style":     map[string]any{"type": "string", "description": "Style profile name or path, from list_styles."},
+		"character": map[string]any{"type": "string", "description": "Optional character profile name or path, from list_characters."},
+		"prompt":    map[string]any{"type": "string", "description": "What the image should show."},
+		"location":  map[string]any{"type": "string", "description": "Where the scene takes place."},
+		"vars":      map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "description": "Variables for the style's prompt_template."},
+		"provider":  map[string]any{"type": "string", "description": "google (default), openai, sd, comfyui, a queue provider, or a comma-separated fallback chain."},
+		"model":     map[string]any{"type": "string", "description": "Model override."},
+		"aspect":    map[string]any{"type": "string", "description": "Aspect ratio as W:H, e.g. 16:9."},
+	}
+
+	mcpTools = []mcpTool{
+		{Name: "list_styles", Description: "List the project's style profiles.", InputSchema: mcpEmptySchema},
+		{Name: "list_characters", Description: "List the project's character profiles.", InputSchema: mcpEmptySchema},
+		{
+			Name:        "compose_prompt",
+			Description: "Compose the exact prompt a generation would send to the provider, without generating.",
+			InputSchema: map[string]any{"type": "object", "properties": mcpComposeProperties, "required": []string{"style", "prompt"}},
+		},
+		{
+			Name:        "generate_image",
+			Description: "Generate an image in a style, optionally featuring a character. Writes the image and its manifest to the output directory and returns both.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": mergeSchemaProperties(mcpComposeProperties, map[string]any{
+					"size":      map[string]any{"type": "string", "description": "Image size as WIDTHxHEIGHT."},
+					"quality":   map[string]any{"type": "string", "description": "OpenAI image quality (low, medium, high)."},
+					"score":     map[string]any{"type": "boolean", "description": "Score the image against the style's reference images."},
+					"min_score": map[string]any{"type": "number", "description": "Regenerate images scoring below this (0..1)."},
+					"cache":     map[string]any{"type": "boolean", "description": "Reuse a cached image for an identical request."},
+				}),
+				"required": []string{"style", "prompt"},
+			},
+		},
+	}
+)
+
+func mergeSchemaProperties(base map[string]any, extra map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(extra))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
+}
+
+// mcpContent is one item of a tool result or resource.
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// callTool runs a tool. Failures are reported in the result, as MCP
+// expects, so the model can read and react to them.
+func (s *mcpServer) callTool(ctx context.Context, name string, arguments json.RawMessage) (mcpToolResult, error) {
+	var value any
+	var err error
+	switch name {
+	case "list_styles":
+		value, err = s.client.ListStyles()
+	case "list_characters":
+		value, err = s.client.ListCharacters()
+	case "compose_prompt":
+		var req generationRequest
+		if err = decodeToolArguments(arguments, &req); err == nil {
+			value, err = s.compose(req)
+		}
+	case "generate_image":
+		var req generationRequest
+		if err = decodeToolArguments(arguments, &req); err == nil {
+			return s.generateImage(ctx, req), nil
+		}
+	default:
+		return mcpToolResult{}, &rpcError{Code: rpcInvalidParams, Message: "unknown tool: " + name}
+	}
+	if err != nil {
+		return mcpErrorResult(err), nil
+	}
+	return mcpJSONResult(value), nil
+}
+
+func (s *mcpServer) generateImage(ctx context.Context, req generationRequest) mcpToolResult {
+	result, err := s.generate(ctx, req)
+	if err != nil {
+		detail := warhol.Describe(err)
+		detail.ManifestPath = result.ManifestPath
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: mustJSON(errorDocument{Error: detail})}}, IsError: true}
+	}
+
+	tool := mcpJSONResult(result)
+	if result.ImagePath == "" {
+		return tool
+	}
+	data, err := os.ReadFile(result.ImagePath)
+	if err != nil {
+		s.logger.Warn("failed to attach image", "path", result.ImagePath, "error", err)
+		return tool
+	}
+	tool.Content = append(tool.Content, mcpContent{Type: "image", Data: base64.StdEncoding.EncodeToString(data), MimeType: "image/png"})
+	return tool
+}
+
+func decodeToolArguments(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return warhol.WithCode(warhol.CodeUsage, fmt.Errorf("invalid arguments: %w", err))
+	}
+	return nil
+}
+
+func mcpJSONResult(value any) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: mustJSON(value)}}}
+}
+
+func mcpErrorResult(err error) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: mustJSON(errorDocument{Error: warhol.Describe(err)})}}, IsError: true}
+}
+
+func mustJSON(value any) string {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"error": {"code": "internal", "message": %q}}`, err.Error())
+	}
+	return string(data)
+}
+
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType"`
+}
+
+// listResources lists every profile and the most recent manifests.
+func (s *mcpServer) listResources() (any, error) {
+	resources := make([]mcpResource, 0, 16)
+	for _, kind := range []string{"styles", "characters"} {
+		list := s.client.ListStyles
+		if kind == "characters" {
+			list = s.client.ListCharacters
+		}
+		profiles, err := list()
+		if err != nil {
+			return nil, err
+		}
+		for _, profile := range profiles {
+			resources = append(resources, mcpResource{
+				URI:         "warhol://" + kind + "/" + profile.Name,
+				Name:        strings.TrimSuffix(kind, "s") + " " + profile.Name,
+				Description: profile.Description,
+				MimeType:    "application/yaml",
+			})
+		}
+	}
+
+	manifests, err := warhol.LoadManifests(s.outDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(manifests) - 1; i >= 0 && i >= len(manifests)-mcpRecentManifests; i-- {
+		stored := manifests[i]
+		id := strings.TrimSuffix(filepath.Base(stored.Path), ".json")
+		resources = append(resources, mcpResource{
+			URI:         "warhol://manifests/" + id,
+			Name:        id,
+			Description: fmt.Sprintf("%s %s: %s", stored.Manifest.Status, stored.Manifest.StyleName(), stored.Manifest.Prompt),
+			MimeType:    "application/json",
+		})
+	}
+	return map[string]any{"resources": resources}, nil
+}
+
+func (s *mcpServer) readResource(uri string) (any, error) {
+	rest, ok := strings.CutPrefix(uri, "warhol://")
+	kind, name, found := strings.Cut(rest, "/")
+	if !ok || !found || name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown resource: " + uri}
+	}
+
+	var path, mimeType string
+	var err error
+	switch kind {
+	case "styles":
+		_, path, err = s.client.LoadStyle(name)
+		mimeType = "application/yaml"
+	case "characters":
+		_, path, err = s.client.LoadCharacter(name)
+		mimeType = "application/yaml"
+	case "manifests":
+		path = filepath.Join(s.outDir, name+".json")
+		mimeType = "application/json"
+	default:
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown resource: " + uri}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return map[string]any{"contents": []map[string]string{{"uri": uri, "mimeType": mimeType, "text": string(data)}}}, nil
+}
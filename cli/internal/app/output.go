@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+// errQueueFull is returned by the HTTP API when no more jobs fit.
+const errQueueFull warhol.ErrorCode = "queue_full"
+
+// output routes command results either to human-readable text or to a
+// single JSON document on stdout. Logs and prompts always go to stderr in
+// JSON mode so stdout stays machine-readable.
+type output struct {
+	stdout io.Writer
+	stderr io.Writer
+	json   bool
+	logger *slog.Logger
+}
+
+type errorDocument struct {
+	Error warhol.ErrorDetail `json:"error"`
+}
+
+func (o *output) printf(format string, args ...any) {
+	if o.json {
+		return
+	}
+	fmt.Fprintf(o.stdout, format, args...)
+}
+
+func (o *output) println(args ...any) {
+	if o.json {
+		return
+	}
+	fmt.Fprintln(o.stdout, args...)
+}
+
+// console is where interactive prompts are written.
+func (o *output) console() io.Writer {
+	if o.json {
+		return o.stderr
+	}
+	return o.stdout
+}
+
+// result emits doc in JSON mode and returns exit code 0.
+func (o *output) result(doc any) int {
+	if !o.json {
+		return 0
+	}
+	if err := o.writeJSON(doc); err != nil {
+		fmt.Fprintf(o.stderr, "failed to encode output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (o *output) writeJSON(doc any) error {
+	encoder := json.NewEncoder(o.stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// fail reports err and returns the exit code. Usage errors exit with 2,
+// everything else with 1.
+func (o *output) fail(err error) int {
+	return o.failDetail(warhol.Describe(err))
+}
+
+func (o *output) failDetail(detail warhol.ErrorDetail) int {
+	exit := 1
+	if detail.Code == warhol.CodeUsage {
+		exit = 2
+	}
+
+	if !o.json {
+		fmt.Fprintln(o.stderr, detail.Message)
+		if detail.ManifestPath != "" {
+			fmt.Fprintf(o.stderr, "Failure manifest saved: %s\n", detail.ManifestPath)
+		}
+		return exit
+	}
+	if encodeErr := o.writeJSON(errorDocument{Error: detail}); encodeErr != nil {
+		fmt.Fprintf(o.stderr, "failed to encode output: %v\n", encodeErr)
+	}
+	return exit
+}
+
+func (o *output) failf(code warhol.ErrorCode, format string, args ...any) int {
+	return o.fail(warhol.WithCode(code, fmt.Errorf(format, args...)))
+}
+
+func (o *output) usage(format string, args ...any) int {
+	return o.failf(warhol.CodeUsage, format, args...)
+}
+
+// flagError reports a flag parsing failure. The flag package has already
+// printed details to stderr.
+func (o *output) flagError(err error) int {
+	if !o.json {
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return o.usage("help requested")
+	}
+	return o.fail(warhol.WithCode(warhol.CodeUsage, err))
+}
+
+type profileInitResult struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
@@ -3,39 +3,166 @@ package app
 import (
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
 )
 
 func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	out := &output{stdout: stdout, stderr: stderr}
+	args, verbose, err := parseGlobalFlags(args, out)
+	if err != nil {
+		return out.fail(err)
+	}
+	out.logger = newLogger(stderr, verbose, out.json)
+
 	if len(args) == 0 {
-		return runWelcome(stdout, stderr)
+		return runWelcome(out)
 	}
 
 	switch args[0] {
 	case "help", "--help", "-h":
+		if out.json {
+			var usage strings.Builder
+			printUsage(&usage)
+			return out.result(map[string]string{"usage": usage.String()})
+		}
 		printUsage(stdout)
 		return 0
 	case "version", "--version", "-v":
-		fmt.Fprintln(stdout, version)
-		return 0
+		out.println(version)
+		return out.result(map[string]string{"version": version})
 	case "style":
-		return runStyle(args[1:], stdout, stderr)
+		return runStyle(args[1:], out)
 	case "character":
-		return runCharacter(args[1:], stdout, stderr)
+		return runCharacter(args[1:], out)
 	case "generate":
-		return runGenerate(args[1:], stdout, stderr)
+		return runGenerate(args[1:], out)
+	case "auth":
+		return runAuth(args[1:], out)
+	case "doctor":
+		return runDoctor(args[1:], out)
+	case "usage":
+		return runUsage(args[1:], out)
+	case "cache":
+		return runCache(args[1:], out)
+	case "score":
+		return runScore(args[1:], out)
+	case "sheet":
+		return runSheet(args[1:], out)
+	case "gallery":
+		return runGallery(args[1:], out)
+	case "serve":
+		return runServe(args[1:], out)
+	case "mcp":
+		return runMCP(args[1:], out)
 	default:
+		if out.json {
+			return out.usage("unknown command: %s", args[0])
+		}
 		fmt.Fprintf(stderr, "unknown command: %s\n\n", args[0])
 		printUsage(stderr)
 		return 2
 	}
 }
 
+// parseGlobalFlags consumes the global options that precede the command
+// and returns the command with its arguments. Parsing stops at the first
+// argument that is not a global option, so command flags and their values
+// are never taken as global ones.
+func parseGlobalFlags(args []string, out *output) ([]string, bool, error) {
+	verbose := false
+	setFormat := func(value string) error {
+		switch value {
+		case "json":
+			out.json = true
+		case "text":
+			out.json = false
+		default:
+			return warhol.WithCode(warhol.CodeUsage, fmt.Errorf("unsupported output format %q (expected text or json)", value))
+		}
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case arg == "--":
+			return args[i+1:], verbose, nil
+		case arg == "--json":
+			out.json = true
+		case arg == "--verbose":
+			verbose = true
+		case name == "--format" || name == "--output" || name == "-o":
+			// --output is the original spelling; it is only read here,
+			// before any command flag of the same name.
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, false, warhol.WithCode(warhol.CodeUsage, fmt.Errorf("%s requires a value (text or json)", arg))
+				}
+				i++
+				value = args[i]
+			}
+			if err := setFormat(value); err != nil {
+				return nil, false, err
+			}
+		default:
+			return args[i:], verbose, nil
+		}
+	}
+	return nil, verbose, nil
+}
+
+// moveFlagsFirst moves positional arguments after the flags so commands
+// accept them in any order, as in `warhol sheet outputs --columns 6`.
+// Flags without an inline value are assumed to take the next argument,
+// except for -h/--help.
+func moveFlagsFirst(args []string) []string {
+	flags := make([]string, 0, len(args))
+	positional := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case arg == "-h" || arg == "--help" || strings.Contains(arg, "="):
+			flags = append(flags, arg)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			flags = append(flags, arg)
+			if i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return append(flags, positional...)
+}
+
 func printUsage(w io.Writer) {
 	fmt.Fprintln(w, "warhol - CLI for creating images in a consistent visual style")
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "Usage:")
-	fmt.Fprintln(w, "  warhol style init <name> [--output <path>]")
+	fmt.Fprintln(w, "  warhol [--format text|json | --json] [--verbose] <command> ...")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  warhol style init <name> [--output <path>] [--from <image>...] [--colors <n>]")
 	fmt.Fprintln(w, "  warhol character init <name> [--output <path>]")
-	fmt.Fprintln(w, "  warhol generate --style <path-or-name> [--character <name-or-path>|-<name>] --prompt <text> [--provider google|openai] [--out-dir <dir>]")
+	fmt.Fprintln(w, "  warhol gallery [--out-dir <dir>] [--output <path>] [--thumb <px>] [--embed]")
+	fmt.Fprintln(w, "  warhol serve [--addr <host:port>] [--out-dir <dir>] [--api [--token <token>]]")
+	fmt.Fprintln(w, "  warhol mcp [--out-dir <dir>]")
+	fmt.Fprintln(w, "  warhol generate --style <path-or-name> [--character <name-or-path>|-<name>] --prompt <text> [--provider google|openai|sd|comfyui] [--ref <image>] [--aspect <W:H>] [--size <WxH>] [--count <n>] [--concurrency <n>] [--ignore-budget] [--cache] [--score] [--min-score <0..1>] [--out-dir <dir>]")
+	fmt.Fprintln(w, "  warhol auth login [--provider google|openai]")
+	fmt.Fprintln(w, "  warhol auth logout [--provider google|openai]")
+	fmt.Fprintln(w, "  warhol auth status")
+	fmt.Fprintln(w, "  warhol doctor [--out-dir <dir>]")
+	fmt.Fprintln(w, "  warhol usage [--since <7d|24h|YYYY-MM-DD>] [--out-dir <dir>]")
+	fmt.Fprintln(w, "  warhol score <image> [--style <path-or-name>] [--min-score <0..1>]")
+	fmt.Fprintln(w, "  warhol sheet [<dir-or-manifest>...] [--columns <n>] [--thumb <px>] [--output <path>]")
+	fmt.Fprintln(w, "  warhol cache ls")
+	fmt.Fprintln(w, "  warhol cache prune [--older-than <30d>] [--max-size <500MB>]")
+	fmt.Fprintln(w, "  warhol cache clear")
 	fmt.Fprintln(w, "  warhol version")
 }
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mattbratos/warhol/cli/internal/imaging"
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+type scoreResult struct {
+	Image        string       `json:"image"`
+	Style        string       `json:"style"`
+	ManifestPath string       `json:"manifest_path,omitempty"`
+	Score        warhol.Score `json:"score"`
+}
+
+func runScore(args []string, out *output) int {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	styleFlag := fs.String("style", "", "Style profile path or name (defaults to the style in the image's manifest)")
+	minScore := fs.Float64("min-score", 0, "Fail when the score is below this value (defaults to the style's score_threshold)")
+	if err := fs.Parse(moveFlagsFirst(args)); err != nil {
+		return out.flagError(err)
+	}
+	if fs.NArg() != 1 {
+		return out.usage("usage: warhol score <image> [--style <path-or-name>] [--min-score <0..1>]")
+	}
+
+	imagePath := fs.Arg(0)
+	result := scoreResult{Image: imagePath}
+
+	manifestPath := warhol.ManifestPathForImage(imagePath)
+	var manifest warhol.Manifest
+	if manifestPath != "" {
+		if err := warhol.ReadManifest(manifestPath, &manifest); err != nil {
+			out.logger.Warn("ignoring unreadable manifest", "path", manifestPath, "error", err)
+			manifestPath = ""
+		}
+	}
+
+	styleInput := *styleFlag
+	if styleInput == "" && manifestPath != "" {
+		styleInput = manifest.StyleFile
+	}
+	if styleInput == "" {
+		return out.usage("no manifest found for %s; pass --style", imagePath)
+	}
+
+	style, stylePath, err := warhol.NewClient(warhol.Options{}).LoadStyle(styleInput)
+	if err != nil {
+		return out.fail(err)
+	}
+	result.Style = stylePath
+
+	threshold := *minScore
+	if threshold == 0 {
+		threshold = style.ScoreThreshold
+	}
+	scorer, err := warhol.NewScorer(style, stylePath, threshold)
+	if err != nil {
+		return out.failf(warhol.CodeProfile, "%v", err)
+	}
+
+	img, err := imaging.DecodeFile(imagePath)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "%v", err)
+	}
+	result.Score = scorer.Score(img)
+
+	if manifestPath != "" {
+		manifest.Score = &result.Score
+		if err := warhol.WriteManifest(manifestPath, manifest); err != nil {
+			return out.fail(err)
+		}
+		result.ManifestPath = manifestPath
+	}
+
+	printScore(out, result.Score)
+	if result.ManifestPath != "" {
+		out.printf("Manifest updated: %s\n", result.ManifestPath)
+	}
+	if code := out.result(result); code != 0 {
+		return code
+	}
+	if passed := result.Score.Passed; passed != nil && !*passed {
+		fmt.Fprintf(out.stderr, "score %.3f is below threshold %.3f\n", result.Score.Score, result.Score.Threshold)
+		return 1
+	}
+	return 0
+}
+
+func printScore(out *output, score warhol.Score) {
+	out.printf("Style score: %.3f (%d reference(s))\n", score.Score, score.References)
+	out.printf("  histogram       %.3f\n", score.Histogram)
+	out.printf("  palette         %.3f\n", score.Palette)
+	out.printf("  edge density    %.3f\n", score.EdgeDensity)
+	out.printf("  perceptual hash %.3f\n", score.PerceptualHash)
+	if score.Passed != nil {
+		verdict := "pass"
+		if !*score.Passed {
+			verdict = "reject"
+		}
+		out.printf("Threshold: %.3f (%s)\n", score.Threshold, verdict)
+	}
+}
@@ -0,0 +1,451 @@
+package app
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+//go:embed assets/serve.html
+var serveHTML []byte
+
+const maxRequestBody = 1 << 20
+
+// server backs the local web UI and the HTTP API. Every request goes
+// through the same profile loading and generation code as the CLI.
+type server struct {
+	logger *slog.Logger
+	outDir string
+	client *warhol.Client
+	// addr is the address the server is bound to. The web UI only answers
+	// requests addressed to it.
+	addr string
+	// root is the project directory that styles, characters, providers
+	// and refs in requests must stay inside.
+	root string
+	// token and queue are only used by the API.
+	token string
+	queue *jobQueue
+}
+
+type serveResult struct {
+	URL    string `json:"url"`
+	OutDir string `json:"out_dir"`
+	API    bool   `json:"api"`
+}
+
+func runServe(args []string, out *output) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	addr := fs.String("addr", "127.0.0.1:8420", "Address to listen on")
+	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Directory for generated artifacts")
+	api := fs.Bool("api", false, "Serve the HTTP/JSON API instead of the web UI")
+	workers := fs.Int("workers", 2, "Number of API generations run in parallel")
+	queueSize := fs.Int("queue-size", 32, "Maximum number of API generations waiting to run")
+	token := fs.String("token", os.Getenv("WARHOL_API_TOKEN"), "Bearer token required by the API (default: $WARHOL_API_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+	if fs.NArg() > 0 {
+		return out.usage("usage: warhol serve [--addr <host:port>] [--out-dir <dir>] [--api [--token <token>] [--workers <n>] [--queue-size <n>]]")
+	}
+	if *workers < 1 {
+		return out.usage("--workers must be at least 1")
+	}
+	if *queueSize < 1 {
+		return out.usage("--queue-size must be at least 1")
+	}
+
+	cfg, _, err := warhol.LoadConfig(defaultProjectPath("."))
+	if err != nil {
+		return out.failf(warhol.CodeUsage, "failed to load config: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to listen on %s: %v", *addr, err)
+	}
+	if !isLoopback(listener.Addr()) && (!*api || *token == "") {
+		out.logger.Warn("listening on a non-loopback address; anyone who can reach it can generate images", "addr", listener.Addr().String())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newServer(out.logger, *outDir, cfg)
+	s.addr = listener.Addr().String()
+	s.token = *token
+	handler := s.routes()
+	if *api {
+		s.queue = newJobQueue(*queueSize)
+		s.queue.start(ctx, *workers, s.generate)
+		handler = s.apiRoutes()
+	}
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	url := "http://" + listener.Addr().String()
+	if *api {
+		out.printf("Serving the warhol API on %s/v1 (Ctrl+C to stop)\n", url)
+	} else {
+		out.printf("Serving warhol on %s (Ctrl+C to stop)\n", url)
+	}
+	if code := out.result(serveResult{URL: url, OutDir: *outDir, API: *api}); code != 0 {
+		return code
+	}
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return out.failf(warhol.CodeIO, "server failed: %v", err)
+	}
+	return 0
+}
+
+// newServer returns a server for the project found from the working
+// directory. The web UI, the API and MCP all only reach files inside it.
+func newServer(logger *slog.Logger, outDir string, cfg warhol.Config) *server {
+	root := defaultProjectPath(".")
+	client := warhol.NewClient(warhol.Options{Root: root, OutDir: outDir, Config: cfg, Logger: logger})
+	return &server{logger: logger, outDir: outDir, client: client, root: root}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /ui/profiles", s.handleProfiles)
+	mux.HandleFunc("POST /ui/compose", s.handleCompose)
+	mux.HandleFunc("POST /ui/generate", s.handleGenerate)
+	mux.HandleFunc("GET /ui/history", s.handleHistory)
+	mux.Handle("GET /files/", http.StripPrefix("/files/", http.FileServer(http.Dir(s.outDir))))
+	return s.logRequests(s.requireSameOrigin(mux))
+}
+
+// requireSameOrigin rejects requests whose Host or Origin is not the
+// address the server is bound to, so other sites cannot post to the UI
+// and DNS rebinding cannot reach it under another name.
+func (s *server) requireSameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := s.allowedHost(r.Host)
+		if origin := r.Header.Get("Origin"); allowed && origin != "" {
+			parsed, err := url.Parse(origin)
+			allowed = err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && s.allowedHost(parsed.Host)
+		}
+		if !allowed {
+			writeHTTPJSON(w, http.StatusForbidden, errorDocument{Error: warhol.ErrorDetail{Code: warhol.CodeUsage, Message: "request is not addressed to " + s.addr}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether host names the listen address. localhost
+// also names a loopback address, and any IP literal names an unspecified
+// one such as 0.0.0.0; other host names are never allowed.
+func (s *server) allowedHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, "80"
+	}
+	listenHost, listenPort, err := net.SplitHostPort(s.addr)
+	if err != nil || port != listenPort {
+		return false
+	}
+	if name == listenHost {
+		return true
+	}
+
+	ip := net.ParseIP(listenHost)
+	switch {
+	case ip == nil:
+		return false
+	case ip.IsUnspecified():
+		return name == "localhost" || net.ParseIP(name) != nil
+	case ip.IsLoopback():
+		return name == "localhost"
+	}
+	return false
+}
+
+func (s *server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		s.logger.Debug("http request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "latency_ms", time.Since(start).Milliseconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(serveHTML)
+}
+
+type profilesResult struct {
+	Styles     []warhol.ProfileSummary `json:"styles"`
+	Characters []warhol.ProfileSummary `json:"characters"`
+}
+
+func (s *server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	styles, err := s.client.ListStyles()
+	if err != nil {
+		writeHTTPError(w, warhol.WithCode(warhol.CodeIO, err))
+		return
+	}
+	characters, err := s.client.ListCharacters()
+	if err != nil {
+		writeHTTPError(w, warhol.WithCode(warhol.CodeIO, err))
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, profilesResult{Styles: styles, Characters: characters})
+}
+
+// generationRequest is the JSON body accepted by the compose and generate
+// endpoints. Empty fields take the same defaults as the generate flags.
+type generationRequest struct {
+	Style     string `json:"style"`
+	Character string `json:"character,omitempty"`
+	Prompt    string `json:"prompt"`
+	Location  string `json:"location,omitempty"`
+	// Vars are passed to the style's prompt_template.
+	Vars     map[string]string `json:"vars,omitempty"`
+	Provider string            `json:"provider,omitempty"`
+	Model    string            `json:"model,omitempty"`
+	Size     string            `json:"size,omitempty"`
+	Aspect   string            `json:"aspect,omitempty"`
+	Quality  string            `json:"quality,omitempty"`
+	Score    bool              `json:"score,omitempty"`
+	MinScore float64           `json:"min_score,omitempty"`
+	Cache    bool              `json:"cache,omitempty"`
+	// Refs are reference image paths on the server's file system. Over
+	// HTTP they are relative to the project root.
+	Refs []string `json:"refs,omitempty"`
+}
+
+// request converts the body to an SDK request. Rejected images are
+// regenerated twice, as with the generate default. The style, character,
+// providers and refs must be paths inside the project root.
+func (s *server) request(req generationRequest) (warhol.Request, error) {
+	for _, field := range []struct{ name, value string }{{"style", req.Style}, {"character", req.Character}} {
+		if field.value != "" && !filepath.IsLocal(field.value) {
+			return warhol.Request{}, warhol.WithCode(warhol.CodeUsage, fmt.Errorf("%s must be a profile name or a path inside the project: %s", field.name, field.value))
+		}
+	}
+	// Queue providers are loaded from YAML like profiles, and that YAML
+	// chooses where requests and the auth token go.
+	for _, entry := range strings.Split(req.Provider, ",") {
+		provider, _, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if provider != "" && !filepath.IsLocal(provider) {
+			return warhol.Request{}, warhol.WithCode(warhol.CodeUsage, fmt.Errorf("provider must be a provider name or a path inside the project: %s", provider))
+		}
+	}
+	refs := make([]string, 0, len(req.Refs))
+	for _, ref := range req.Refs {
+		if !filepath.IsLocal(ref) {
+			return warhol.Request{}, warhol.WithCode(warhol.CodeUsage, fmt.Errorf("ref must be a path inside the project: %s", ref))
+		}
+		refs = append(refs, filepath.Join(s.root, ref))
+	}
+	req.Refs = refs
+
+	return warhol.Request{
+		Style:      req.Style,
+		Character:  req.Character,
+		Prompt:     req.Prompt,
+		Location:   req.Location,
+		Vars:       req.Vars,
+		Provider:   req.Provider,
+		Model:      req.Model,
+		Size:       req.Size,
+		Aspect:     req.Aspect,
+		Quality:    req.Quality,
+		Refs:       req.Refs,
+		Cache:      req.Cache,
+		Score:      req.Score,
+		MinScore:   req.MinScore,
+		MaxRejects: 2,
+	}, nil
+}
+
+func (s *server) handleCompose(w http.ResponseWriter, r *http.Request) {
+	var req generationRequest
+	if err := readHTTPJSON(w, r, &req); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	preview, err := s.compose(req)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, preview)
+}
+
+func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req generationRequest
+	if err := readHTTPJSON(w, r, &req); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	result, err := s.generate(r.Context(), req)
+	if err != nil {
+		detail := warhol.Describe(err)
+		detail.ManifestPath = result.ManifestPath
+		writeHTTPJSON(w, httpStatusFor(detail.Code), errorDocument{Error: detail})
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, s.historyItemFor(warhol.StoredManifest{Path: result.ManifestPath, Manifest: result.Manifest}))
+}
+
+// generate runs one generation the way `warhol generate` does. The
+// server cannot prompt for a missing API key, so that is an error.
+func (s *server) generate(ctx context.Context, req generationRequest) (warhol.Result, error) {
+	request, err := s.request(req)
+	if err != nil {
+		return warhol.Result{}, err
+	}
+	return s.client.Generate(ctx, request)
+}
+
+// compose returns the prompt a generation would be sent with.
+func (s *server) compose(req generationRequest) (warhol.Prompt, error) {
+	request, err := s.request(req)
+	if err != nil {
+		return warhol.Prompt{}, err
+	}
+	return s.client.Compose(request)
+}
+
+// historyItem is a manifest with the URL its image is served from.
+type historyItem struct {
+	ID        string          `json:"id"`
+	Style     string          `json:"style"`
+	Character string          `json:"character,omitempty"`
+	ImageURL  string          `json:"image_url,omitempty"`
+	Manifest  warhol.Manifest `json:"manifest"`
+}
+
+type historyResult struct {
+	Items []historyItem `json:"items"`
+	Total int           `json:"total"`
+}
+
+func (s *server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 60
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeHTTPError(w, warhol.WithCode(warhol.CodeUsage, fmt.Errorf("invalid limit %q", value)))
+			return
+		}
+		limit = parsed
+	}
+
+	manifests, err := warhol.LoadManifests(s.outDir)
+	if err != nil {
+		writeHTTPError(w, warhol.WithCode(warhol.CodeIO, err))
+		return
+	}
+
+	result := historyResult{Items: make([]historyItem, 0, min(limit, len(manifests))), Total: len(manifests)}
+	for i := len(manifests) - 1; i >= 0 && len(result.Items) < limit; i-- {
+		result.Items = append(result.Items, s.historyItemFor(manifests[i]))
+	}
+	writeHTTPJSON(w, http.StatusOK, result)
+}
+
+func (s *server) historyItemFor(stored warhol.StoredManifest) historyItem {
+	item := historyItem{
+		ID:        strings.TrimSuffix(filepath.Base(stored.Path), ".json"),
+		Style:     stored.Manifest.StyleName(),
+		Character: stored.Manifest.CharacterName(),
+		Manifest:  stored.Manifest,
+	}
+	if imagePath := stored.ImageFile(); imagePath != "" {
+		if rel, err := relativeURL(s.outDir, imagePath); err == nil && !strings.HasPrefix(rel, "../") {
+			item.ImageURL = "/files/" + rel
+		}
+	}
+	return item
+}
+
+func readHTTPJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return warhol.WithCode(warhol.CodeUsage, errors.New("request body must have Content-Type: application/json"))
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return warhol.WithCode(warhol.CodeUsage, fmt.Errorf("invalid request body: %w", err))
+	}
+	return nil
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, doc any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(doc)
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	detail := warhol.Describe(err)
+	writeHTTPJSON(w, httpStatusFor(detail.Code), errorDocument{Error: detail})
+}
+
+// httpStatusFor maps an error code to the HTTP status it is served with.
+func httpStatusFor(code warhol.ErrorCode) int {
+	switch code {
+	case warhol.CodeUsage, warhol.CodeProfile:
+		return http.StatusBadRequest
+	case warhol.CodeContentPolicy, warhol.CodeRejected:
+		return http.StatusUnprocessableEntity
+	case warhol.CodeBudget, errQueueFull:
+		return http.StatusTooManyRequests
+	case warhol.CodeProvider:
+		return http.StatusBadGateway
+	case warhol.CodeAuth:
+		// The server itself is missing provider credentials.
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,242 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/internal/imaging"
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+var (
+	sheetBackground = color.RGBA{24, 24, 27, 255}
+	sheetCell       = color.RGBA{39, 39, 42, 255}
+	sheetText       = color.RGBA{228, 228, 231, 255}
+	sheetMuted      = color.RGBA{161, 161, 170, 255}
+)
+
+const (
+	sheetPadding      = 16
+	sheetGap          = 12
+	sheetCaptionLines = 3
+)
+
+type sheetItem struct {
+	ImagePath string   `json:"image_path"`
+	Caption   []string `json:"caption"`
+}
+
+type sheetResult struct {
+	Path    string      `json:"path"`
+	Columns int         `json:"columns"`
+	Rows    int         `json:"rows"`
+	Items   []sheetItem `json:"items"`
+}
+
+func runSheet(args []string, out *output) int {
+	fs := flag.NewFlagSet("sheet", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	columns := fs.Int("columns", 4, "Number of columns in the grid")
+	thumb := fs.Int("thumb", 256, "Thumbnail size in pixels")
+	outputPath := fs.String("output", "", "Path of the sheet PNG (default: sheet-<timestamp>.png in the first directory)")
+	title := fs.String("title", "", "Title printed above the grid")
+	if err := fs.Parse(moveFlagsFirst(args)); err != nil {
+		return out.flagError(err)
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{defaultProjectPath("outputs")}
+	}
+	if *columns < 1 {
+		return out.usage("--columns must be at least 1")
+	}
+	if *thumb < 64 {
+		return out.usage("--thumb must be at least 64")
+	}
+
+	items, err := collectSheetItems(inputs)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read manifests: %v", err)
+	}
+	if len(items) == 0 {
+		return out.failf(warhol.CodeUsage, "no generated images found in %s", strings.Join(inputs, ", "))
+	}
+
+	path := *outputPath
+	if path == "" {
+		dir := inputs[0]
+		if !dirExists(dir) {
+			dir = filepath.Dir(dir)
+		}
+		path = filepath.Join(dir, "sheet-"+time.Now().UTC().Format("20060102-150405")+".png")
+	}
+	if *title == "" {
+		*title = fmt.Sprintf("%s - %d image(s)", strings.Join(inputs, ", "), len(items))
+	}
+
+	sheet := renderSheet(items, *columns, *thumb, *title, out)
+	if err := writePNG(path, sheet); err != nil {
+		return out.failf(warhol.CodeIO, "failed to write sheet: %v", err)
+	}
+
+	cols := min(*columns, len(items))
+	rows := (len(items) + cols - 1) / cols
+	out.printf("Sheet saved: %s (%d image(s), %dx%d grid)\n", path, len(items), cols, rows)
+	return out.result(sheetResult{Path: path, Columns: cols, Rows: rows, Items: items})
+}
+
+// collectSheetItems reads manifests from directories, manifest files or
+// images written by generate, oldest first.
+func collectSheetItems(inputs []string) ([]sheetItem, error) {
+	items := make([]sheetItem, 0)
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.IsDir() {
+			manifests, err := warhol.LoadManifests(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, stored := range manifests {
+				if item, ok := sheetItemFor(stored); ok {
+					items = append(items, item)
+				}
+			}
+			continue
+		}
+
+		if filepath.Ext(input) == ".json" {
+			var manifest warhol.Manifest
+			if err := warhol.ReadManifest(input, &manifest); err != nil {
+				return nil, fmt.Errorf("%s: %w", input, err)
+			}
+			if item, ok := sheetItemFor(warhol.StoredManifest{Path: input, Manifest: manifest}); ok {
+				items = append(items, item)
+			}
+			continue
+		}
+
+		var manifest warhol.Manifest
+		if path := warhol.ManifestPathForImage(input); path != "" && warhol.ReadManifest(path, &manifest) == nil {
+			manifest.ImagePath = input
+			if item, ok := sheetItemFor(warhol.StoredManifest{Path: path, Manifest: manifest}); ok {
+				items = append(items, item)
+				continue
+			}
+		}
+		items = append(items, sheetItem{ImagePath: input, Caption: []string{filepath.Base(input)}})
+	}
+	return items, nil
+}
+
+func sheetItemFor(stored warhol.StoredManifest) (sheetItem, bool) {
+	manifest := stored.Manifest
+	imagePath := stored.ImageFile()
+	if imagePath == "" {
+		return sheetItem{}, false
+	}
+	if _, err := os.Stat(imagePath); err != nil {
+		return sheetItem{}, false
+	}
+
+	subject := manifest.StyleName()
+	if character := manifest.CharacterName(); character != "" {
+		subject = character + " / " + subject
+	}
+
+	details := manifest.Provider
+	if manifest.Seed != nil {
+		details = fmt.Sprintf("seed %d | %s", *manifest.Seed, details)
+	}
+	if manifest.Score != nil {
+		details += fmt.Sprintf(" | score %.2f", manifest.Score.Score)
+	}
+
+	return sheetItem{
+		ImagePath: imagePath,
+		Caption:   []string{subject, promptSlug(manifest.Prompt), details},
+	}, true
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+func promptSlug(prompt string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(prompt), "-"), "-")
+}
+
+// renderSheet lays items out in a grid of thumb x thumb cells with a
+// caption below each. Images that fail to decode leave an empty cell.
+func renderSheet(items []sheetItem, columns int, thumb int, title string, out *output) *image.RGBA {
+	columns = min(columns, len(items))
+	rows := (len(items) + columns - 1) / columns
+	scale := max(thumb/256, 1)
+	captionHeight := sheetCaptionLines*lineHeight*scale + sheetGap/2
+	titleHeight := lineHeight*scale*2 + sheetGap
+	cellHeight := thumb + captionHeight
+
+	width := sheetPadding*2 + columns*thumb + (columns-1)*sheetGap
+	height := sheetPadding*2 + titleHeight + rows*cellHeight + (rows-1)*sheetGap
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), &image.Uniform{sheetBackground}, image.Point{}, draw.Src)
+
+	maxChars := (width - 2*sheetPadding) / (glyphAdvance * scale * 2)
+	drawText(sheet, sheetPadding, sheetPadding, truncate(title, maxChars), scale*2, sheetText)
+
+	maxChars = thumb / (glyphAdvance * scale)
+	for i, item := range items {
+		x := sheetPadding + (i%columns)*(thumb+sheetGap)
+		y := sheetPadding + titleHeight + (i/columns)*(cellHeight+sheetGap)
+		cell := image.Rect(x, y, x+thumb, y+thumb)
+		draw.Draw(sheet, cell, &image.Uniform{sheetCell}, image.Point{}, draw.Src)
+
+		img, err := imaging.DecodeFile(item.ImagePath)
+		if err != nil {
+			out.logger.Warn("skipping undecodable image", "path", item.ImagePath, "error", err)
+		} else {
+			thumbnail := imaging.Fit(img, thumb, thumb)
+			offset := image.Pt(x+(thumb-thumbnail.Bounds().Dx())/2, y+(thumb-thumbnail.Bounds().Dy())/2)
+			draw.Draw(sheet, thumbnail.Bounds().Add(offset), thumbnail, image.Point{}, draw.Src)
+		}
+
+		for line, text := range item.Caption {
+			if line >= sheetCaptionLines {
+				break
+			}
+			textColor := sheetMuted
+			if line == 0 {
+				textColor = sheetText
+			}
+			drawText(sheet, x, y+thumb+sheetGap/2+line*lineHeight*scale, truncate(text, maxChars), scale, textColor)
+		}
+	}
+	return sheet
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -4,39 +4,53 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/mattbratos/warhol/cli/internal/imaging"
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
 )
 
-func runStyle(args []string, stdout io.Writer, stderr io.Writer) int {
+func runStyle(args []string, out *output) int {
 	if len(args) == 0 {
-		fmt.Fprintln(stderr, "missing style subcommand (expected: init)")
-		return 2
+		return out.usage("missing style subcommand (expected: init)")
 	}
 
 	switch args[0] {
 	case "init":
-		return runStyleInit(args[1:], stdout, stderr)
+		return runStyleInit(args[1:], out)
 	default:
-		fmt.Fprintf(stderr, "unknown style subcommand: %s\n", args[0])
-		return 2
+		return out.usage("unknown style subcommand: %s", args[0])
 	}
 }
 
-func runStyleInit(args []string, stdout io.Writer, stderr io.Writer) int {
+type styleInitResult struct {
+	profileInitResult
+	Palette    []string `json:"palette,omitempty"`
+	Brightness float64  `json:"brightness,omitempty"`
+	Contrast   float64  `json:"contrast,omitempty"`
+	References []string `json:"references,omitempty"`
+}
+
+func runStyleInit(args []string, out *output) int {
 	fs := flag.NewFlagSet("style init", flag.ContinueOnError)
-	fs.SetOutput(stderr)
+	fs.SetOutput(out.stderr)
 
 	output := fs.String("output", "", "Path to output YAML file")
-	if err := fs.Parse(args); err != nil {
-		return 2
+	colors := fs.Int("colors", imaging.PaletteSize, "Number of palette colors to extract with --from")
+	var from stringList
+	fs.Var(&from, "from", "Example image to derive the palette from (repeatable; following image paths are included)")
+	if err := fs.Parse(moveFlagsFirst(expandFromArgs(args))); err != nil {
+		return out.flagError(err)
 	}
 
 	rest := fs.Args()
 	if len(rest) != 1 {
-		fmt.Fprintln(stderr, "usage: warhol style init <name> [--output <path>]")
-		return 2
+		return out.usage("usage: warhol style init <name> [--output <path>] [--from <image>...] [--colors <n>]")
+	}
+	if *colors < 1 {
+		return out.usage("--colors must be at least 1")
 	}
 
 	name := rest[0]
@@ -45,16 +59,143 @@ func runStyleInit(args []string, stdout io.Writer, stderr io.Writer) int {
 		path = filepath.Join(defaultProjectPath("styles"), name+".yaml")
 	}
 
-	if err := writeStyleTemplate(path, name); err != nil {
-		fmt.Fprintf(stderr, "failed to write style template: %v\n", err)
-		return 1
+	var analysis *styleAnalysis
+	if len(from) > 0 {
+		// Check before copying references for a style that cannot be written.
+		if _, err := os.Stat(path); err == nil {
+			return out.failf(warhol.CodeIO, "failed to write style template: file already exists")
+		}
+		var err error
+		analysis, err = analyzeStyleImages(from, *colors)
+		if err != nil {
+			return out.failf(warhol.CodeIO, "failed to analyze example images: %v", err)
+		}
+		if analysis.References, err = copyStyleReferences(path, name, from); err != nil {
+			return out.failf(warhol.CodeIO, "failed to copy example images: %v", err)
+		}
+	}
+
+	if err := writeStyleTemplate(path, name, analysis); err != nil {
+		return out.failf(warhol.CodeIO, "failed to write style template: %v", err)
+	}
+
+	result := styleInitResult{profileInitResult: profileInitResult{Kind: "style", Name: name, Path: path}}
+	out.printf("Created style template: %s\n", path)
+	if analysis != nil {
+		for _, color := range analysis.Palette {
+			result.Palette = append(result.Palette, color.Hex())
+		}
+		result.Brightness = analysis.Brightness
+		result.Contrast = analysis.Contrast
+		result.References = analysis.References
+		out.printf("Palette: %s\n", strings.Join(result.Palette, " "))
+		out.printf("Brightness: %.2f (%s), contrast: %.2f (%s)\n", analysis.Brightness, brightnessLabel(analysis.Brightness), analysis.Contrast, contrastLabel(analysis.Contrast))
+		out.printf("References: %s\n", strings.Join(analysis.References, ", "))
+	}
+	return out.result(result)
+}
+
+// styleAnalysis is what style init --from derives from example images.
+type styleAnalysis struct {
+	Palette    []imaging.Color
+	Brightness float64
+	Contrast   float64
+	// References are the copied example images, relative to the style file.
+	References []string
+}
+
+// analyzeStyleImages pools the pixels of every image into one median-cut
+// palette and averages their brightness and contrast.
+func analyzeStyleImages(paths []string, colors int) (*styleAnalysis, error) {
+	analysis := &styleAnalysis{}
+	pooled := make([][3]uint8, 0, len(paths)*imaging.FeatureMaxSide*imaging.FeatureMaxSide)
+	for _, path := range paths {
+		img, err := imaging.DecodeFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pixels := imaging.Downsample(img, imaging.FeatureMaxSide)
+		pooled = append(pooled, pixels.Colors...)
+
+		brightness, contrast := imaging.LuminanceStats(imaging.Grayscale(pixels))
+		analysis.Brightness += brightness
+		analysis.Contrast += contrast
 	}
 
-	fmt.Fprintf(stdout, "Created style template: %s\n", path)
-	return 0
+	analysis.Palette = imaging.MedianCutPalette(pooled, colors)
+	analysis.Brightness = imaging.Round(analysis.Brightness / float64(len(paths)))
+	analysis.Contrast = imaging.Round(analysis.Contrast / float64(len(paths)))
+	return analysis, nil
 }
 
-func writeStyleTemplate(path string, styleName string) error {
+// copyStyleReferences copies example images next to the new style so the
+// style stays self-contained, returning paths relative to the style file.
+func copyStyleReferences(stylePath string, name string, images []string) ([]string, error) {
+	dir := filepath.Join(filepath.Dir(stylePath), "references", name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(images))
+	used := map[string]int{}
+	for _, image := range images {
+		data, err := os.ReadFile(image)
+		if err != nil {
+			return nil, err
+		}
+
+		base := filepath.Base(image)
+		if n := used[base]; n > 0 {
+			ext := filepath.Ext(base)
+			base = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), n+1, ext)
+		}
+		used[filepath.Base(image)]++
+
+		if err := os.WriteFile(filepath.Join(dir, base), data, 0o644); err != nil {
+			return nil, err
+		}
+		refs = append(refs, filepath.ToSlash(filepath.Join("references", name, base)))
+	}
+	return refs, nil
+}
+
+func brightnessLabel(brightness float64) string {
+	switch {
+	case brightness < 0.35:
+		return "dark, low-key lighting"
+	case brightness > 0.65:
+		return "bright, high-key lighting"
+	}
+	return "balanced exposure"
+}
+
+func contrastLabel(contrast float64) string {
+	switch {
+	case contrast < 0.15:
+		return "low contrast, soft tonal range"
+	case contrast > 0.28:
+		return "high contrast, deep shadows and strong highlights"
+	}
+	return "moderate contrast"
+}
+
+// expandFromArgs turns `--from a.png b.png` into repeated --from flags.
+func expandFromArgs(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--from" && args[i] != "-from" {
+			expanded = append(expanded, args[i])
+			continue
+		}
+		for i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			expanded = append(expanded, "--from="+args[i])
+		}
+	}
+	return expanded
+}
+
+func writeStyleTemplate(path string, styleName string, analysis *styleAnalysis) error {
 	if _, err := os.Stat(path); err == nil {
 		return errors.New("file already exists")
 	} else if !errors.Is(err, os.ErrNotExist) {
@@ -65,17 +206,42 @@ func writeStyleTemplate(path string, styleName string) error {
 		return err
 	}
 
+	promptPrefix := `  - "Define the core visual style in plain language."
+`
+	palette := `  - "#111111"
+  - "#f4f4f4"
+`
+	references := ""
+	if analysis != nil {
+		hexes := make([]string, 0, len(analysis.Palette))
+		var paletteLines strings.Builder
+		for _, color := range analysis.Palette {
+			hexes = append(hexes, color.Hex())
+			fmt.Fprintf(&paletteLines, "  - %q # %.0f%%\n", color.Hex(), color.Weight*100)
+		}
+		palette = paletteLines.String()
+		promptPrefix += fmt.Sprintf("  - %q\n  - %q\n  - %q\n",
+			"color palette of "+strings.Join(hexes, ", "),
+			brightnessLabel(analysis.Brightness),
+			contrastLabel(analysis.Contrast))
+
+		var refLines strings.Builder
+		refLines.WriteString("\n# Golden images for `warhol score`, relative to this file.\nreferences:\n")
+		for _, ref := range analysis.References {
+			fmt.Fprintf(&refLines, "  - %q\n", ref)
+		}
+		refLines.WriteString("# score_threshold: 0.65\n")
+		references = refLines.String()
+	}
+
 	content := fmt.Sprintf(`# warhol style profile
 name: %s
 description: "Short description of the intended visual identity."
 
 prompt_prefix:
-  - "Define the core visual style in plain language."
-
+%s
 palette:
-  - "#111111"
-  - "#f4f4f4"
-
+%s
 camera:
   lens: "35mm"
   framing: "medium shot"
@@ -85,10 +251,24 @@ negative_prompt:
   - "avoid brand marks"
   - "avoid unrelated text"
 
+# Optional Go text/template that replaces the default prompt composition.
+# It can use .Style, .Character (nil without one), .Location, .Prompt and
+# .Vars (from --var key=value).
+# prompt_template: |
+#   {{.Prompt}}{{with .Character}}, featuring {{.Name}}: {{join .Traits ", "}}{{end}}.
+#   {{with .Location}}Set in {{.}}.{{end}} {{join .Style.PromptPrefix ", "}}.
+
 seed_policy:
   mode: "fixed" # fixed | random
   seed: 42
-`, styleName)
+
+# Used by --provider sd (Automatic1111/Forge API).
+stable_diffusion:
+  sampler: "DPM++ 2M"
+  steps: 30
+  cfg_scale: 7
+  denoising_strength: 0.75 # img2img only
+%s`, styleName, promptPrefix, palette, references)
 
 	return os.WriteFile(path, []byte(content), 0o644)
 }
@@ -0,0 +1,5 @@
+package app
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
+)
+
+type usageRow struct {
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	Style            string  `json:"style"`
+	Images           int     `json:"images"`
+	Cached           int     `json:"cached"`
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+type usageResult struct {
+	Since            string     `json:"since,omitempty"`
+	OutDir           string     `json:"out_dir"`
+	Images           int        `json:"images"`
+	Cached           int        `json:"cached"`
+	EstimatedCostUSD float64    `json:"estimated_cost_usd"`
+	Rows             []usageRow `json:"rows"`
+}
+
+func runUsage(args []string, out *output) int {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	fs.SetOutput(out.stderr)
+
+	since := fs.String("since", "", "Only count generations newer than this (7d, 24h or YYYY-MM-DD)")
+	outDir := fs.String("out-dir", defaultProjectPath("outputs"), "Directory containing generated artifacts")
+	if err := fs.Parse(args); err != nil {
+		return out.flagError(err)
+	}
+
+	cutoff, err := parseSince(*since, time.Now())
+	if err != nil {
+		return out.usage("invalid --since %q: %v", *since, err)
+	}
+
+	manifests, err := warhol.LoadManifests(*outDir)
+	if err != nil {
+		return out.failf(warhol.CodeIO, "failed to read manifests: %v", err)
+	}
+
+	rows := map[[3]string]*usageRow{}
+	result := usageResult{Since: *since, OutDir: *outDir}
+	for _, stored := range manifests {
+		manifest := stored.Manifest
+		// Rejected images were generated and paid for too.
+		if manifest.Status != "succeeded" && manifest.Status != "rejected" {
+			continue
+		}
+		if !cutoff.IsZero() && manifest.Time().Before(cutoff) {
+			continue
+		}
+
+		key := [3]string{manifest.Provider, manifest.Model, manifest.StyleName()}
+		row, ok := rows[key]
+		if !ok {
+			row = &usageRow{Provider: key[0], Model: key[1], Style: key[2]}
+			rows[key] = row
+		}
+		// Cache hits reused an earlier image without calling the provider.
+		if cache := manifest.Cache; cache != nil && cache.Hit {
+			row.Cached++
+			result.Cached++
+			continue
+		}
+		row.Images++
+		result.Images++
+		if usage := manifest.Usage; usage != nil {
+			row.InputTokens += usage.InputTokens
+			row.OutputTokens += usage.OutputTokens
+			row.EstimatedCostUSD = warhol.RoundCost(row.EstimatedCostUSD + usage.EstimatedCostUSD)
+			result.EstimatedCostUSD = warhol.RoundCost(result.EstimatedCostUSD + usage.EstimatedCostUSD)
+		}
+	}
+
+	result.Rows = make([]usageRow, 0, len(rows))
+	for _, row := range rows {
+		result.Rows = append(result.Rows, *row)
+	}
+	sort.Slice(result.Rows, func(i, j int) bool {
+		a, b := result.Rows[i], result.Rows[j]
+		if a.EstimatedCostUSD != b.EstimatedCostUSD {
+			return a.EstimatedCostUSD > b.EstimatedCostUSD
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.Style < b.Style
+	})
+
+	if out.json {
+		return out.result(result)
+	}
+	if len(result.Rows) == 0 {
+		fmt.Fprintf(out.stdout, "No generations found in %s\n", *outDir)
+		return 0
+	}
+	printUsageTable(out.stdout, result)
+	return 0
+}
+
+func printUsageTable(w io.Writer, result usageResult) {
+	providerWidth, modelWidth, styleWidth := len("PROVIDER"), len("MODEL"), len("STYLE")
+	for _, row := range result.Rows {
+		providerWidth = max(providerWidth, len(row.Provider))
+		modelWidth = max(modelWidth, len(row.Model))
+		styleWidth = max(styleWidth, len(row.Style))
+	}
+
+	format := fmt.Sprintf("%%-%ds %%-%ds %%-%ds %%6s %%6s %%10s %%10s %%10s\n", providerWidth, modelWidth, styleWidth)
+	fmt.Fprintf(w, format, "PROVIDER", "MODEL", "STYLE", "IMAGES", "CACHED", "IN_TOKENS", "OUT_TOKENS", "COST_USD")
+	for _, row := range result.Rows {
+		fmt.Fprintf(w, format, row.Provider, row.Model, row.Style,
+			fmt.Sprint(row.Images), fmt.Sprint(row.Cached), fmt.Sprint(row.InputTokens), fmt.Sprint(row.OutputTokens), fmt.Sprintf("%.4f", row.EstimatedCostUSD))
+	}
+	fmt.Fprintf(w, format, "TOTAL", "", "", fmt.Sprint(result.Images), fmt.Sprint(result.Cached), "", "", fmt.Sprintf("%.4f", result.EstimatedCostUSD))
+}
+
+// parseSince accepts a relative window such as 7d, 24h or 30m, or an
+// absolute YYYY-MM-DD date.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		duration, err := time.ParseDuration(days + "h")
+		if err == nil && duration >= 0 {
+			return now.Add(-24 * duration), nil
+		}
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, errors.New("expected a duration like 7d or 24h, or a date like 2024-01-31")
+	}
+	return now.Add(-duration), nil
+}
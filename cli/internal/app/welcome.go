@@ -1,21 +1,20 @@
 package app
 
 import (
-	"fmt"
-	"io"
+	"github.com/mattbratos/warhol/cli/pkg/warhol"
 )
 
-func runWelcome(stdout io.Writer, stderr io.Writer) int {
-	fmt.Fprintln(stdout, "Hello! Welcome to warhol.")
-	fmt.Fprintln(stdout, "I can generate images in a consistent style, and I need your Google API key first.")
+func runWelcome(out *output) int {
+	out.println("Hello! Welcome to warhol.")
+	out.println("I can generate images in a consistent style, and I need your Google API key first.")
 
-	if err := ensureGoogleAPIKey(stdout, stderr); err != nil {
-		fmt.Fprintf(stderr, "setup failed: %v\n", err)
-		return 1
+	if err := ensureAPIKey("google", !out.json, out.console()); err != nil {
+		return out.failf(warhol.CodeAuth, "setup failed: %v", err)
 	}
 
-	fmt.Fprintln(stdout)
-	fmt.Fprintln(stdout, "You're ready. Try this next:")
-	fmt.Fprintln(stdout, `warhol generate --style 16bit -matt --prompt "full body portrait, city street at night"`)
-	return 0
+	out.println()
+	out.println("You're ready. Try this next:")
+	out.println(`warhol generate --style 16bit -matt --prompt "full body portrait, city street at night"`)
+	out.println("To use OpenAI as well, run: warhol auth login --provider openai")
+	return out.result(map[string]bool{"ready": true})
 }
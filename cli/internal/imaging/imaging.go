@@ -0,0 +1,309 @@
+// Package imaging extracts the image features used for style scoring and
+// provides the small raster helpers shared by the CLI.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// Features are the style signals warhol compares between images.
+type Features struct {
+	Histogram   []float64
+	Palette     []Color
+	EdgeDensity float64
+	Hash        uint64
+	Brightness  float64
+	Contrast    float64
+}
+
+// Color is one dominant color and the share of pixels it covers.
+type Color struct {
+	R, G, B uint8
+	Weight  float64
+}
+
+// Hex formats c as #rrggbb.
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+const (
+	histogramBins    = 8
+	FeatureMaxSide   = 256
+	PaletteSize      = 6
+	edgeThreshold    = 96.0
+	perceptualSide   = 32
+	perceptualBlocks = 8
+)
+
+// DecodeFile reads and decodes a PNG, JPEG or GIF image.
+func DecodeFile(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// ExtractFeatures computes every feature from a downsampled copy of img.
+func ExtractFeatures(img image.Image) Features {
+	pixels := Downsample(img, FeatureMaxSide)
+	gray := Grayscale(pixels)
+	brightness, contrast := LuminanceStats(gray)
+	return Features{
+		Histogram:   colorHistogram(pixels),
+		Palette:     MedianCutPalette(pixels.Colors, PaletteSize),
+		EdgeDensity: edgeDensity(gray),
+		Hash:        perceptualHash(img),
+		Brightness:  brightness,
+		Contrast:    contrast,
+	}
+}
+
+// Pixels is a small RGB raster in row-major order.
+type Pixels struct {
+	Width, Height int
+	Colors        [][3]uint8
+}
+
+// Downsample box-filters img so its longest side is at most maxSide.
+func Downsample(img image.Image, maxSide int) Pixels {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	scale := math.Max(float64(srcW), float64(srcH)) / float64(maxSide)
+	if scale < 1 {
+		scale = 1
+	}
+	w := max(int(float64(srcW)/scale), 1)
+	h := max(int(float64(srcH)/scale), 1)
+
+	return Resize(img, w, h)
+}
+
+// Gray is a grayscale raster with luminance values in 0..255.
+type Gray struct {
+	Width, Height int
+	Values        []float64
+}
+
+// Grayscale converts pixels using Rec. 601 luma weights.
+func Grayscale(pixels Pixels) Gray {
+	gray := Gray{Width: pixels.Width, Height: pixels.Height, Values: make([]float64, len(pixels.Colors))}
+	for i, c := range pixels.Colors {
+		gray.Values[i] = 0.299*float64(c[0]) + 0.587*float64(c[1]) + 0.114*float64(c[2])
+	}
+	return gray
+}
+
+// LuminanceStats returns mean brightness and its standard deviation, both
+// scaled to 0..1.
+func LuminanceStats(gray Gray) (float64, float64) {
+	var sum, sumSquares float64
+	for _, v := range gray.Values {
+		sum += v
+		sumSquares += v * v
+	}
+	n := float64(len(gray.Values))
+	mean := sum / n
+	variance := math.Max(sumSquares/n-mean*mean, 0)
+	return mean / 255, math.Sqrt(variance) / 255
+}
+
+// colorHistogram is a normalized RGB histogram with histogramBins bins
+// per channel.
+func colorHistogram(pixels Pixels) []float64 {
+	histogram := make([]float64, histogramBins*histogramBins*histogramBins)
+	shift := 8 - bits.Len(histogramBins-1)
+	for _, c := range pixels.Colors {
+		r, g, b := int(c[0])>>shift, int(c[1])>>shift, int(c[2])>>shift
+		histogram[(r*histogramBins+g)*histogramBins+b]++
+	}
+	for i := range histogram {
+		histogram[i] /= float64(len(pixels.Colors))
+	}
+	return histogram
+}
+
+// MedianCutPalette splits the color space along its widest channel until
+// there are size boxes, and returns each box's mean color ordered by how
+// many pixels it covers.
+func MedianCutPalette(colors [][3]uint8, size int) []Color {
+	if len(colors) == 0 {
+		return nil
+	}
+
+	boxes := [][][3]uint8{append([][3]uint8(nil), colors...)}
+	for len(boxes) < size {
+		widest, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			ch, s := widestChannel(box)
+			if s > spread {
+				widest, channel, spread = i, ch, s
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.Slice(box, func(a, b int) bool { return box[a][channel] < box[b][channel] })
+		mid := len(box) / 2
+		boxes[widest] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	palette := make([]Color, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b int
+		for _, c := range box {
+			r += int(c[0])
+			g += int(c[1])
+			b += int(c[2])
+		}
+		n := len(box)
+		palette = append(palette, Color{
+			R:      uint8(r / n),
+			G:      uint8(g / n),
+			B:      uint8(b / n),
+			Weight: float64(n) / float64(len(colors)),
+		})
+	}
+	sort.SliceStable(palette, func(a, b int) bool { return palette[a].Weight > palette[b].Weight })
+	return palette
+}
+
+func widestChannel(box [][3]uint8) (int, int) {
+	channel, spread := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, c := range box {
+			lo = min(lo, int(c[ch]))
+			hi = max(hi, int(c[ch]))
+		}
+		if hi-lo > spread {
+			channel, spread = ch, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+// edgeDensity is the share of pixels whose Sobel gradient exceeds
+// edgeThreshold.
+func edgeDensity(gray Gray) float64 {
+	w, h := gray.Width, gray.Height
+	if w < 3 || h < 3 {
+		return 0
+	}
+
+	at := func(x, y int) float64 { return gray.Values[y*w+x] }
+	edges := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			if math.Hypot(gx, gy) > edgeThreshold {
+				edges++
+			}
+		}
+	}
+	return float64(edges) / float64((w-2)*(h-2))
+}
+
+// perceptualHash is a 64-bit DCT hash: bits are set where the low
+// frequency coefficients of a 32x32 grayscale copy exceed their median.
+func perceptualHash(img image.Image) uint64 {
+	small := Grayscale(Resize(img, perceptualSide, perceptualSide))
+
+	coefficients := make([]float64, 0, perceptualBlocks*perceptualBlocks)
+	for u := 0; u < perceptualBlocks; u++ {
+		for v := 0; v < perceptualBlocks; v++ {
+			var sum float64
+			for y := 0; y < perceptualSide; y++ {
+				for x := 0; x < perceptualSide; x++ {
+					sum += small.Values[y*perceptualSide+x] *
+						math.Cos(float64(2*x+1)*float64(v)*math.Pi/(2*perceptualSide)) *
+						math.Cos(float64(2*y+1)*float64(u)*math.Pi/(2*perceptualSide))
+				}
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// The DC term only reflects overall brightness.
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// Resize box-filters img to exactly w by h pixels.
+func Resize(img image.Image, w int, h int) Pixels {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	out := Pixels{Width: w, Height: h, Colors: make([][3]uint8, w*h)}
+	for y := 0; y < h; y++ {
+		y0 := bounds.Min.Y + y*srcH/h
+		y1 := max(bounds.Min.Y+(y+1)*srcH/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := bounds.Min.X + x*srcW/w
+			x1 := max(bounds.Min.X+(x+1)*srcW/w, x0+1)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := img.At(sx, sy).RGBA()
+					r += uint64(pr >> 8)
+					g += uint64(pg >> 8)
+					b += uint64(pb >> 8)
+					n++
+				}
+			}
+			out.Colors[y*w+x] = [3]uint8{uint8(r / n), uint8(g / n), uint8(b / n)}
+		}
+	}
+	return out
+}
+
+// Fit scales img to fit within w x h, keeping its aspect ratio.
+func Fit(img image.Image, w int, h int) *image.RGBA {
+	bounds := img.Bounds()
+	ratio := min(float64(w)/float64(bounds.Dx()), float64(h)/float64(bounds.Dy()))
+	tw := max(int(float64(bounds.Dx())*ratio), 1)
+	th := max(int(float64(bounds.Dy())*ratio), 1)
+
+	pixels := Resize(img, tw, th)
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for i, c := range pixels.Colors {
+		out.SetRGBA(i%tw, i/tw, color.RGBA{c[0], c[1], c[2], 255})
+	}
+	return out
+}
+
+// Round rounds value to three decimal places.
+func Round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
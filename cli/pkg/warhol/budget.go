@@ -0,0 +1,248 @@
+package warhol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BudgetConfig caps how much a run or a calendar day may generate. Zero
+// means unlimited.
+type BudgetConfig struct {
+	MaxImagesPerRun int     `yaml:"max_images_per_run"`
+	MaxImagesPerDay int     `yaml:"max_images_per_day"`
+	MaxCostPerRun   float64 `yaml:"max_cost_per_run"`
+	MaxCostPerDay   float64 `yaml:"max_cost_per_day"`
+}
+
+func (b BudgetConfig) enabled() bool {
+	return b.MaxImagesPerRun > 0 || b.MaxImagesPerDay > 0 || b.MaxCostPerRun > 0 || b.MaxCostPerDay > 0
+}
+
+// budgetError reports the limit that would be exceeded by the next call.
+type budgetError struct {
+	Limit string
+	Used  float64
+	Next  float64
+	Max   float64
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("budget exceeded: %s is %s, %s already used and the next image needs %s (pass --ignore-budget to override)",
+		e.Limit, e.format(e.Max), e.format(e.Used), e.format(e.Next))
+}
+
+func (e *budgetError) format(value float64) string {
+	if e.Limit == "max_cost_per_run" || e.Limit == "max_cost_per_day" {
+		return fmt.Sprintf("$%.4f", value)
+	}
+	return fmt.Sprint(value)
+}
+
+// budgetUsage is what a run or a day has spent so far.
+type budgetUsage struct {
+	Images  int     `json:"images"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// budgetLedger is the on-disk record of daily spend, shared by every warhol
+// process of the user.
+type budgetLedger struct {
+	Days map[string]budgetUsage `json:"days"`
+}
+
+// ledgerRetention is how many days of history the ledger keeps.
+const ledgerRetention = 31
+
+type budgetReservation struct {
+	day     string
+	costUSD float64
+}
+
+// budgetTracker enforces BudgetConfig before each provider call. Every call
+// reserves one image at its estimated price and is settled with the actual
+// cost afterwards, so concurrent processes never overshoot a shared limit.
+type budgetTracker struct {
+	mu      sync.Mutex
+	limits  BudgetConfig
+	ignore  bool
+	path    string
+	pricing map[string]ModelPricing
+	logger  *slog.Logger
+	run     budgetUsage
+}
+
+func newBudgetTracker(limits BudgetConfig, ignore bool, pricing map[string]ModelPricing, logger *slog.Logger) *budgetTracker {
+	tracker := &budgetTracker{limits: limits, ignore: ignore, pricing: pricing, logger: logger}
+	if dir, err := ConfigDir(); err == nil {
+		tracker.path = filepath.Join(dir, "ledger.json")
+	}
+	return tracker
+}
+
+// reserve checks the budget for one image from provider and model and
+// records it in the ledger.
+func (b *budgetTracker) reserve(provider string, model string, quality string) (budgetReservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	reservation := budgetReservation{
+		day:     time.Now().Format("2006-01-02"),
+		costUSD: estimateCost(b.pricing, provider, model, quality, nil).EstimatedCostUSD,
+	}
+
+	if !b.ignore {
+		if err := b.limits.check("max_images_per_run", float64(b.run.Images), 1, float64(b.limits.MaxImagesPerRun)); err != nil {
+			return reservation, err
+		}
+		if err := b.limits.check("max_cost_per_run", b.run.CostUSD, reservation.costUSD, b.limits.MaxCostPerRun); err != nil {
+			return reservation, err
+		}
+	}
+
+	err := b.updateLedger(func(ledger *budgetLedger) error {
+		day := ledger.Days[reservation.day]
+		if !b.ignore {
+			if err := b.limits.check("max_images_per_day", float64(day.Images), 1, float64(b.limits.MaxImagesPerDay)); err != nil {
+				return err
+			}
+			if err := b.limits.check("max_cost_per_day", day.CostUSD, reservation.costUSD, b.limits.MaxCostPerDay); err != nil {
+				return err
+			}
+		}
+		day.Images++
+		day.CostUSD = RoundCost(day.CostUSD + reservation.costUSD)
+		ledger.Days[reservation.day] = day
+		return nil
+	})
+	if err != nil {
+		return reservation, err
+	}
+
+	b.run.Images++
+	b.run.CostUSD = RoundCost(b.run.CostUSD + reservation.costUSD)
+	return reservation, nil
+}
+
+// settle replaces the reserved estimate with the actual cost, or releases
+// the reservation when the call produced no image.
+func (b *budgetTracker) settle(reservation budgetReservation, usage *Usage, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	images := 0
+	delta := -reservation.costUSD
+	if failed {
+		images = -1
+	} else if usage != nil {
+		delta += usage.EstimatedCostUSD
+	} else {
+		delta = 0
+	}
+	if images == 0 && delta == 0 {
+		return
+	}
+
+	b.run.Images += images
+	b.run.CostUSD = RoundCost(b.run.CostUSD + delta)
+	err := b.updateLedger(func(ledger *budgetLedger) error {
+		day := ledger.Days[reservation.day]
+		day.Images = max(day.Images+images, 0)
+		day.CostUSD = max(RoundCost(day.CostUSD+delta), 0)
+		ledger.Days[reservation.day] = day
+		return nil
+	})
+	if err != nil {
+		b.logger.Warn("failed to update budget ledger", "path", b.path, "error", err)
+	}
+}
+
+func (limits BudgetConfig) check(name string, used float64, next float64, limit float64) error {
+	if limit <= 0 || used+next <= limit {
+		return nil
+	}
+	return WithCode(CodeBudget, &budgetError{Limit: name, Used: used, Next: next, Max: limit})
+}
+
+// updateLedger applies fn to the ledger while holding an exclusive lock on
+// it. Ledger problems only fail the call when a daily limit depends on it.
+func (b *budgetTracker) updateLedger(fn func(*budgetLedger) error) error {
+	dailyLimits := !b.ignore && (b.limits.MaxImagesPerDay > 0 || b.limits.MaxCostPerDay > 0)
+	ledgerError := func(err error) error {
+		if dailyLimits {
+			return WithCode(CodeIO, fmt.Errorf("budget ledger: %w", err))
+		}
+		b.logger.Warn("failed to update budget ledger", "path", b.path, "error", err)
+		return nil
+	}
+
+	if b.path == "" {
+		return ledgerError(errors.New("user config directory is unavailable"))
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil {
+		return ledgerError(err)
+	}
+
+	unlock, err := lockFile(b.path + ".lock")
+	if err != nil {
+		return ledgerError(err)
+	}
+	defer unlock()
+
+	ledger, err := readLedger(b.path)
+	if err != nil {
+		return ledgerError(err)
+	}
+	if err := fn(&ledger); err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -ledgerRetention).Format("2006-01-02")
+	for day := range ledger.Days {
+		if day < cutoff {
+			delete(ledger.Days, day)
+		}
+	}
+	if err := writeLedger(b.path, ledger); err != nil {
+		return ledgerError(err)
+	}
+	return nil
+}
+
+func readLedger(path string) (budgetLedger, error) {
+	ledger := budgetLedger{Days: map[string]budgetUsage{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return ledger, err
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return ledger, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if ledger.Days == nil {
+		ledger.Days = map[string]budgetUsage{}
+	}
+	return ledger, nil
+}
+
+// writeLedger replaces the ledger atomically so a crash never leaves a
+// truncated file behind.
+func writeLedger(path string, ledger budgetLedger) error {
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,109 @@
+package warhol
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testBudgetPricing = map[string]ModelPricing{"test-model": {PerImage: 0.25}}
+
+// reserveConcurrently calls reserve on tracker(i) from n goroutines at once
+// and returns how many reservations succeeded.
+func reserveConcurrently(t *testing.T, n int, tracker func(i int) *budgetTracker) int {
+	t.Helper()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		granted int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(b *budgetTracker) {
+			defer wg.Done()
+			_, err := b.reserve("test", "test-model", "")
+			if err != nil && CodeOf(err) != CodeBudget {
+				t.Errorf("reserve: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}(tracker(i))
+	}
+	wg.Wait()
+	return granted
+}
+
+func TestBudgetDailyLimitAcrossTrackers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("WARHOL_CONFIG_DIR", dir)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Each tracker stands in for a separate warhol process, so only the
+	// ledger lock keeps them under the shared daily limit.
+	limits := BudgetConfig{MaxImagesPerDay: 5}
+	granted := reserveConcurrently(t, 20, func(int) *budgetTracker {
+		return newBudgetTracker(limits, false, testBudgetPricing, logger)
+	})
+	if granted != 5 {
+		t.Errorf("granted %d reservations, want 5", granted)
+	}
+
+	ledger, err := readLedger(filepath.Join(dir, "ledger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := ledger.Days[time.Now().Format("2006-01-02")]
+	if day.Images != 5 || day.CostUSD != 1.25 {
+		t.Errorf("ledger day = %+v, want 5 images costing $1.25", day)
+	}
+}
+
+func TestBudgetRunLimitWithinTracker(t *testing.T) {
+	t.Setenv("WARHOL_CONFIG_DIR", t.TempDir())
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tracker := newBudgetTracker(BudgetConfig{MaxCostPerRun: 1}, false, testBudgetPricing, logger)
+	if granted := reserveConcurrently(t, 20, func(int) *budgetTracker { return tracker }); granted != 4 {
+		t.Errorf("granted %d reservations, want 4", granted)
+	}
+
+	// A failed call releases its reservation for the next one.
+	tracker.settle(budgetReservation{day: time.Now().Format("2006-01-02"), costUSD: 0.25}, nil, true)
+	if _, err := tracker.reserve("test", "test-model", ""); err != nil {
+		t.Errorf("reserve after a release: %v", err)
+	}
+	if _, err := tracker.reserve("test", "test-model", ""); CodeOf(err) != CodeBudget {
+		t.Errorf("reserve over the limit: error = %v, want a budget error", err)
+	}
+}
+
+func TestBudgetSkippedWithoutLimits(t *testing.T) {
+	t.Setenv("WARHOL_CONFIG_DIR", t.TempDir())
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "styles"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "styles", "plain.yaml"), []byte("name: plain\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, budget := range map[string]*BudgetConfig{"unset": nil, "zero": {}} {
+		t.Run(name, func(t *testing.T) {
+			client := NewClient(Options{Root: root, OutDir: t.TempDir(), Config: Config{Budget: budget}})
+			job, err := client.prepare(Request{Style: "plain", Prompt: "cat", DryRun: true}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.budget != nil {
+				t.Error("job has a budget tracker without any limit")
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package warhol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheInfo records whether a manifest's image came from the generation
+// cache.
+type CacheInfo struct {
+	Key string `json:"key"`
+	Hit bool   `json:"hit"`
+}
+
+// CacheEntry is the metadata stored next to each cached image.
+type CacheEntry struct {
+	Key       string `json:"key"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+	Seed      *int64 `json:"seed,omitempty"`
+	CreatedAt string `json:"created_at"`
+	Bytes     int64  `json:"bytes"`
+	// LastUsedAt is the image file's modification time, bumped on each hit.
+	LastUsedAt string `json:"last_used_at"`
+	Path       string `json:"path"`
+}
+
+// cacheKeyInput is everything that influences a provider's output. Its
+// JSON encoding is hashed into the cache key.
+type cacheKeyInput struct {
+	Provider          string      `json:"provider"`
+	Model             string      `json:"model"`
+	Prompt            string      `json:"prompt"`
+	NegativePrompt    string      `json:"negative_prompt,omitempty"`
+	SystemInstruction string      `json:"system_instruction,omitempty"`
+	Size              string      `json:"size,omitempty"`
+	AspectRatio       string      `json:"aspect_ratio,omitempty"`
+	Quality           string      `json:"quality,omitempty"`
+	Seed              *int64      `json:"seed,omitempty"`
+	References        []string    `json:"references,omitempty"`
+	StableDiffusion   *SDSettings `json:"stable_diffusion,omitempty"`
+	Workflow          string      `json:"workflow,omitempty"`
+}
+
+// CacheDir is where generated images are cached: $WARHOL_CACHE_DIR, or
+// warhol/generations under the user cache directory.
+func CacheDir() (string, error) {
+	if dir := strings.TrimSpace(os.Getenv("WARHOL_CACHE_DIR")); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "warhol", "generations"), nil
+}
+
+// cacheKey hashes the rendered request for manifest. Reference images and
+// ComfyUI workflows are hashed by content so edits invalidate the entry.
+func (j *generationJob) cacheKey(manifest Manifest) (string, error) {
+	input := cacheKeyInput{
+		Provider:          manifest.Provider,
+		Model:             manifest.Model,
+		Prompt:            manifest.FinalPrompt,
+		NegativePrompt:    manifest.NegativePrompt,
+		SystemInstruction: manifest.SystemInstruction,
+		Size:              manifest.Size,
+		AspectRatio:       manifest.AspectRatio,
+		Quality:           manifest.Quality,
+		Seed:              manifest.Seed,
+	}
+	for _, path := range manifest.References {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		input.References = append(input.References, sum)
+	}
+
+	switch manifest.Provider {
+	case "sd":
+		settings := j.style.StableDiffusion
+		input.StableDiffusion = &settings
+	case "comfyui":
+		path, err := comfyUIWorkflowPath(j.style, manifest.StyleFile)
+		if err != nil {
+			return "", err
+		}
+		if input.Workflow, err = hashFile(path); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// validCacheKey reports whether key is a SHA-256 hex digest, the only
+// form cacheKey produces. Keys read from disk are checked before they are
+// used to build paths.
+func validCacheKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range key {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheEntryPaths returns the image and metadata paths for a valid key.
+func cacheEntryPaths(dir string, key string) (string, string) {
+	base := filepath.Join(dir, key[:2], key)
+	return base + ".png", base + ".json"
+}
+
+// lookupCache returns the cached image for key, marking it as recently used.
+func lookupCache(dir string, key string) ([]byte, CacheEntry, bool) {
+	imagePath, metaPath := cacheEntryPaths(dir, key)
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, CacheEntry{}, false
+	}
+
+	var entry CacheEntry
+	data, err := os.ReadFile(metaPath)
+	if err != nil || json.Unmarshal(data, &entry) != nil {
+		return nil, CacheEntry{}, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(imagePath, now, now)
+	return image, entry, true
+}
+
+// storeCache writes image and its metadata under key. Files are renamed
+// into place so concurrent readers never see partial entries.
+func storeCache(dir string, entry CacheEntry, image []byte) error {
+	imagePath, metaPath := cacheEntryPaths(dir, entry.Key)
+	if err := os.MkdirAll(filepath.Dir(imagePath), 0o755); err != nil {
+		return err
+	}
+
+	entry.Bytes = int64(len(image))
+	entry.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(metaPath, append(meta, '\n')); err != nil {
+		return err
+	}
+	return writeFileAtomic(imagePath, image)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ListCache returns every complete cache entry, most recently used first.
+// Metadata with an invalid key, or stored under another key's name, is
+// skipped.
+func ListCache(dir string) ([]CacheEntry, error) {
+	entries := make([]CacheEntry, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		var entry CacheEntry
+		data, err := os.ReadFile(path)
+		if err != nil || json.Unmarshal(data, &entry) != nil || !validCacheKey(entry.Key) {
+			return nil
+		}
+		imagePath, metaPath := cacheEntryPaths(dir, entry.Key)
+		if filepath.Clean(path) != filepath.Clean(metaPath) {
+			return nil
+		}
+		info, err := os.Stat(imagePath)
+		if err != nil {
+			return nil
+		}
+		entry.Bytes = info.Size()
+		entry.LastUsedAt = info.ModTime().UTC().Format(time.RFC3339)
+		entry.Path = imagePath
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsedAt > entries[j].LastUsedAt
+	})
+	return entries, nil
+}
+
+// RemoveCacheEntry deletes the cached image and metadata stored under key.
+// Missing files are not an error, but an invalid key is.
+func RemoveCacheEntry(dir string, key string) error {
+	if !validCacheKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+	imagePath, metaPath := cacheEntryPaths(dir, key)
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(imagePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
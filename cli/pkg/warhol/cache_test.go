@@ -0,0 +1,57 @@
+package warhol
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheIgnoresTamperedKeys(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "warhol", "generations")
+	valid := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+	if err := storeCache(dir, CacheEntry{Key: valid, Provider: "test"}, []byte("image")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key of "../x" would resolve outside the cache directory, so leave
+	// a file there to show it is never touched.
+	victim := filepath.Join(dir, "..", "..", "x.png")
+	if err := os.WriteFile(victim, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tampered := map[string]string{
+		"ab/traversal.json":     `{"key": "../x"}`,
+		"ab/short.json":         `{"key": "abc"}`,
+		"ab/upper.json":         `{"key": "` + strings.ToUpper(valid) + `"}`,
+		"ab/renamed.json":       `{"key": "` + valid + `"}`,
+		"cd/" + other + ".json": `{"key": "` + valid + `"}`,
+	}
+	for name, meta := range tampered {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(meta), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ListCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != valid {
+		t.Errorf("ListCache = %+v, want only the %s entry", entries, valid)
+	}
+
+	for _, key := range []string{"../x", "abc", strings.ToUpper(valid)} {
+		if err := RemoveCacheEntry(dir, key); err == nil {
+			t.Errorf("RemoveCacheEntry(%q) succeeded, want an error", key)
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("file outside the cache was removed: %v", err)
+	}
+}
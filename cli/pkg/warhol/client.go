@@ -0,0 +1,463 @@
+package warhol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Options configure a Client. The zero value is usable.
+type Options struct {
+	// Root is the project directory that styles/, characters/,
+	// providers/ and wildcards/ are looked up in, and that relative
+	// profile paths are resolved against. It defaults to the working
+	// directory and its parent.
+	Root string
+	// OutDir is where images and manifests are written. It defaults to
+	// "outputs".
+	OutDir string
+	// Config supplies the fallback chain, pricing, budget and rate
+	// limits, usually from LoadConfig.
+	Config Config
+	// Logger receives provider traces and warnings. It defaults to
+	// discarding them.
+	Logger *slog.Logger
+	// IgnoreBudget lets generations run past an exhausted budget.
+	IgnoreBudget bool
+}
+
+// Client loads profiles, composes prompts and generates images the way
+// the warhol CLI does. Profile names are looked up in styles/ and
+// characters/ under Options.Root. A Client is safe for concurrent use, and all of its
+// generations share one set of rate limiters.
+type Client struct {
+	opts     Options
+	roots    profileRoots
+	logger   *slog.Logger
+	pricing  map[string]ModelPricing
+	limiters *rateLimiters
+}
+
+// NewClient returns a client configured by opts.
+func NewClient(opts Options) *Client {
+	if opts.OutDir == "" {
+		opts.OutDir = "outputs"
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	roots := defaultProfileRoots
+	if opts.Root != "" {
+		roots = profileRoots{opts.Root}
+	}
+	return &Client{
+		opts:     opts,
+		roots:    roots,
+		logger:   logger,
+		pricing:  pricingTable(opts.Config.Pricing),
+		limiters: newRateLimiters(opts.Config.RateLimits),
+	}
+}
+
+// Request describes one generation. Style and Prompt are required.
+type Request struct {
+	// Style and Character are profile names or paths to YAML files.
+	Style     string
+	Character string
+	Prompt    string
+	// Location describes where the scene takes place. The default
+	// composition appends it before Prompt; prompt templates read it as
+	// .Location.
+	Location string
+	// Vars are passed to the style's prompt_template as .Vars.
+	Vars map[string]string
+	// Wildcards records how Prompt was expanded. Expand sets it.
+	Wildcards *Wildcards
+	// Provider is google (the default), openai, sd, comfyui, a queue
+	// provider from providers/, or a comma-separated fallback chain such
+	// as "google,openai:gpt-image-1".
+	Provider string
+	// Model overrides the first provider's default model.
+	Model string
+	// Size (WIDTHxHEIGHT) and Aspect (W:H) are mapped to the closest
+	// geometry each provider supports.
+	Size   string
+	Aspect string
+	// Quality is passed to OpenAI and defaults to medium.
+	Quality string
+	// Refs are reference image paths sent with the prompt.
+	Refs []string
+	// DryRun composes the prompt and writes the manifest without calling
+	// a provider.
+	DryRun bool
+	// Cache reuses an image generated for an identical request and caches
+	// new images.
+	Cache bool
+	// Score scores the image against the style's reference images, as
+	// does a MinScore above zero. Images below MinScore, or the style's
+	// score_threshold when MinScore is zero, are rejected and regenerated
+	// up to MaxRejects times.
+	Score      bool
+	MinScore   float64
+	MaxRejects int
+}
+
+// options validates req and fills in the defaults and client settings.
+func (c *Client) options(req Request) (generateOptions, error) {
+	if req.Style == "" || req.Prompt == "" {
+		return generateOptions{}, WithCode(CodeUsage, errors.New("style and prompt are required"))
+	}
+	if req.MinScore < 0 || req.MinScore > 1 {
+		return generateOptions{}, WithCode(CodeUsage, errors.New("min score must be between 0 and 1"))
+	}
+	if req.MaxRejects < 0 {
+		return generateOptions{}, WithCode(CodeUsage, errors.New("max rejects must not be negative"))
+	}
+
+	opts := generateOptions{
+		Style:      req.Style,
+		Character:  req.Character,
+		Prompt:     req.Prompt,
+		Location:   req.Location,
+		Vars:       req.Vars,
+		Wildcards:  req.Wildcards,
+		Roots:      c.roots,
+		OutDir:     c.opts.OutDir,
+		Provider:   req.Provider,
+		Model:      req.Model,
+		Size:       req.Size,
+		Aspect:     req.Aspect,
+		Quality:    req.Quality,
+		DryRun:     req.DryRun,
+		Refs:       req.Refs,
+		Fallback:   c.opts.Config.Fallback,
+		Pricing:    c.pricing,
+		Cache:      req.Cache,
+		Score:      req.Score || req.MinScore > 0,
+		MinScore:   req.MinScore,
+		MaxRejects: req.MaxRejects,
+	}
+	if opts.Provider == "" {
+		opts.Provider = "google"
+	}
+	if opts.Quality == "" {
+		opts.Quality = "medium"
+	}
+	return opts, nil
+}
+
+// LoadStyle loads a style profile by name or path and returns it with the
+// file it was read from.
+func (c *Client) LoadStyle(nameOrPath string) (Style, string, error) {
+	style, path, err := c.roots.loadStyle(nameOrPath)
+	if err != nil {
+		return Style{}, "", WithCode(CodeProfile, fmt.Errorf("failed to load style profile: %w", err))
+	}
+	return style, path, nil
+}
+
+// LoadCharacter loads a character profile by name or path and returns it
+// with the file it was read from.
+func (c *Client) LoadCharacter(nameOrPath string) (Character, string, error) {
+	character, path, err := c.roots.loadCharacter(nameOrPath)
+	if err != nil {
+		return Character{}, "", WithCode(CodeProfile, fmt.Errorf("failed to load character profile: %w", err))
+	}
+	return character, path, nil
+}
+
+// ProfileDirs returns the existing directories that profiles of kind
+// ("styles", "characters", "providers" or "wildcards") are looked up in.
+func (c *Client) ProfileDirs(kind string) []string {
+	return c.roots.dirs(kind)
+}
+
+// ProfileSummary describes one discovered style, character or provider
+// profile.
+type ProfileSummary struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+	// Error is set when the profile fails to load or validate.
+	Error string `json:"error,omitempty"`
+	// Warning is set when the profile loads but is not ready to use, such
+	// as a provider whose API key variable is unset.
+	Warning string `json:"warning,omitempty"`
+}
+
+// ListStyles loads every style profile. Profiles that fail to load are
+// listed with their error.
+func (c *Client) ListStyles() ([]ProfileSummary, error) {
+	return c.discoverProfiles("styles", func(path string) (string, error) {
+		profile, _, err := c.roots.loadStyle(path)
+		if err == nil {
+			err = validateStyleProfile(profile)
+		}
+		return profile.Description, err
+	})
+}
+
+// ListCharacters loads every character profile. Profiles that fail to
+// load are listed with their error.
+func (c *Client) ListCharacters() ([]ProfileSummary, error) {
+	return c.discoverProfiles("characters", func(path string) (string, error) {
+		profile, _, err := c.roots.loadCharacter(path)
+		if err == nil {
+			err = validateCharacterProfile(profile)
+		}
+		return profile.Description, err
+	})
+}
+
+// ListProviders loads every queue provider definition in providers/.
+func (c *Client) ListProviders() ([]ProfileSummary, error) {
+	summaries, err := c.discoverProfiles("providers", func(path string) (string, error) {
+		_, _, err := c.roots.loadQueueProvider(path)
+		return "", err
+	})
+	for i, summary := range summaries {
+		if summary.Error != "" {
+			continue
+		}
+		def, _, _ := c.roots.loadQueueProvider(summary.Path)
+		if def.Auth.Env != "" && strings.TrimSpace(os.Getenv(def.Auth.Env)) == "" {
+			summaries[i].Warning = def.Auth.Env + " is not set"
+		}
+	}
+	return summaries, err
+}
+
+func (c *Client) discoverProfiles(kind string, load func(path string) (string, error)) ([]ProfileSummary, error) {
+	paths, err := c.roots.list(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ProfileSummary, 0, len(paths))
+	for _, path := range paths {
+		summary := ProfileSummary{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Path: path}
+		description, err := load(path)
+		if err != nil {
+			summary.Error = err.Error()
+		}
+		summary.Description = description
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Prompt is the prompt a generation would send to its first provider.
+type Prompt struct {
+	Provider          string      `json:"provider"`
+	Model             string      `json:"model"`
+	Composition       Composition `json:"composition"`
+	Text              string      `json:"text"`
+	FinalPrompt       string      `json:"final_prompt"`
+	NegativePrompt    string      `json:"negative_prompt,omitempty"`
+	SystemInstruction string      `json:"system_instruction,omitempty"`
+}
+
+// Compose composes the prompt req would send without calling a provider.
+// Unlike Generate it skips reference, workflow and scoring checks, so it
+// is cheap enough to run on every keystroke.
+func (c *Client) Compose(req Request) (Prompt, error) {
+	opts, err := c.options(req)
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	style, _, err := c.LoadStyle(opts.Style)
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	var character *Character
+	if opts.Character != "" {
+		loaded, _, err := c.LoadCharacter(opts.Character)
+		if err != nil {
+			return Prompt{}, err
+		}
+		character = &loaded
+	}
+
+	targets, err := resolveProviderChain(c.roots, opts.Provider, opts.Model, opts.Fallback)
+	if err != nil {
+		return Prompt{}, WithCode(CodeUsage, fmt.Errorf("invalid model/provider: %w", err))
+	}
+
+	composed, err := composePrompt(style, character, opts)
+	if err != nil {
+		return Prompt{}, err
+	}
+	composed.AspectRatio = opts.Aspect
+	rendered := renderPrompt(c.roots, targets[0].Provider, composed)
+	return Prompt{
+		Provider:          targets[0].Provider,
+		Model:             targets[0].Model,
+		Composition:       composed,
+		Text:              composedText(composed),
+		FinalPrompt:       rendered.Prompt,
+		NegativePrompt:    rendered.NegativePrompt,
+		SystemInstruction: rendered.SystemInstruction,
+	}, nil
+}
+
+// Generate runs one generation, trying each provider of the fallback
+// chain in turn, and writes its image and manifest to the output
+// directory. A failed generation still returns the path of the manifest
+// recording the failure when one was written.
+func (c *Client) Generate(ctx context.Context, req Request) (Result, error) {
+	job, err := c.prepare(req, 1)
+	if err != nil {
+		return Result{}, err
+	}
+	return job.runWithRejects(ctx)
+}
+
+// prepare loads the profiles for req and attaches a fresh budget tracker,
+// when a budget is configured, and the client's rate limiters. Fixed seeds advance by seedStride per
+// rejected image.
+func (c *Client) prepare(req Request, seedStride int64) (*generationJob, error) {
+	opts, err := c.options(req)
+	if err != nil {
+		return nil, err
+	}
+	job, err := prepareGeneration(c.logger, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits := c.opts.Config.Budget; limits != nil && limits.enabled() {
+		job.budget = newBudgetTracker(*limits, c.opts.IgnoreBudget, c.pricing, c.logger)
+	}
+	job.limiters = c.limiters
+	job.seedStride = seedStride
+
+	if provider := job.manifest.Provider; !opts.DryRun && IsCredentialProvider(provider) {
+		if _, err := RequireAPIKey(provider); err != nil {
+			return nil, WithCode(CodeAuth, err)
+		}
+	}
+	return job, nil
+}
+
+// BatchOptions control GenerateBatch and GenerateAll.
+type BatchOptions struct {
+	// Count is the number of images to generate per request.
+	Count int
+	// Concurrency is how many images are generated in parallel. It
+	// defaults to 1.
+	Concurrency int
+	// OnResult is called as each image finishes, with its index in the
+	// batch: image i of request k has index k*Count+i. Calls are
+	// serialized.
+	OnResult func(index int, result Result, err error)
+}
+
+// GenerateBatch generates opts.Count images for req against one shared
+// budget. Fixed seeds step by one per image so each image differs
+// reproducibly. A budget error stops new work; images that were never
+// started are left out of the result.
+func (c *Client) GenerateBatch(ctx context.Context, req Request, opts BatchOptions) (BatchResult, error) {
+	return c.GenerateAll(ctx, []Request{req}, opts)
+}
+
+// GenerateAll is GenerateBatch for several requests, such as the
+// expansions returned by Expand. Every request is validated before any
+// image is generated, and all of them share one budget.
+func (c *Client) GenerateAll(ctx context.Context, reqs []Request, opts BatchOptions) (BatchResult, error) {
+	if opts.Count < 1 {
+		return BatchResult{}, WithCode(CodeUsage, errors.New("count must be at least 1"))
+	}
+	jobs := make([]*generationJob, len(reqs))
+	for k, req := range reqs {
+		job, err := c.prepare(req, int64(opts.Count))
+		if err != nil {
+			return BatchResult{}, err
+		}
+		if k > 0 {
+			job.budget = jobs[0].budget
+		}
+		jobs[k] = job
+	}
+	total := len(jobs) * opts.Count
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stopped bool
+		done    = make([]bool, total)
+		results = make([]Result, total)
+		batch   BatchResult
+	)
+
+	indexes := make(chan int)
+	for range min(max(opts.Concurrency, 1), total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				item := *jobs[i/opts.Count]
+				item.seedOffset = int64(i % opts.Count)
+				result, err := item.runWithRejects(ctx)
+
+				mu.Lock()
+				done[i] = true
+				results[i] = result
+				if err != nil {
+					batch.Failed++
+					if CodeOf(err) == CodeBudget {
+						// Every remaining image would hit the same limit.
+						stopped = true
+					}
+				} else {
+					batch.Succeeded++
+					if usage := result.Manifest.Usage; usage != nil {
+						batch.EstimatedCostUSD = RoundCost(batch.EstimatedCostUSD + usage.EstimatedCostUSD)
+					}
+				}
+				if opts.OnResult != nil {
+					opts.OnResult(i, result, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < total; i++ {
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	batch.Results = make([]Result, 0, total)
+	for i, result := range results {
+		if done[i] {
+			batch.Results = append(batch.Results, result)
+		}
+	}
+	// Limiters outlive the batch, so add up this batch's own waits.
+	for _, result := range batch.Results {
+		batch.RateLimitWaitMS += result.Timings.RateLimitWaitMS
+		for key, waited := range result.Timings.RateLimitWaits {
+			if batch.RateLimitWaits == nil {
+				batch.RateLimitWaits = map[string]int64{}
+			}
+			batch.RateLimitWaits[key] += waited
+		}
+	}
+	return batch, nil
+}
@@ -0,0 +1,425 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultComfyUIBaseURL = "http://127.0.0.1:8188"
+	defaultComfyUIModel   = "workflow"
+	comfyUIPollInterval   = time.Second
+	comfyUITimeout        = 10 * time.Minute
+)
+
+// comfyUIClient queues a workflow on a ComfyUI server, waits for it in
+// /history and downloads the first output image via /view.
+type comfyUIClient struct {
+	baseURL  string
+	clientID string
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+type comfyUIImageRef struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+type comfyUIHistoryEntry struct {
+	Status struct {
+		StatusStr string            `json:"status_str"`
+		Completed bool              `json:"completed"`
+		Messages  []json.RawMessage `json:"messages"`
+	} `json:"status"`
+	Outputs map[string]struct {
+		Images []comfyUIImageRef `json:"images"`
+	} `json:"outputs"`
+}
+
+func newComfyUIClient(logger *slog.Logger) (*comfyUIClient, error) {
+	baseURL := strings.TrimSpace(os.Getenv("COMFYUI_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultComfyUIBaseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &comfyUIClient{
+		baseURL:  baseURL,
+		clientID: hex.EncodeToString(id),
+		client:   &http.Client{Timeout: 60 * time.Second},
+		logger:   logger,
+	}, nil
+}
+
+// comfyUIWorkflowPath resolves the style's workflow file relative to the
+// style profile.
+func comfyUIWorkflowPath(style Style, styleFile string) (string, error) {
+	workflow := strings.TrimSpace(style.ComfyUI.Workflow)
+	if workflow == "" {
+		return "", errors.New("style has no comfyui.workflow")
+	}
+	if filepath.IsAbs(workflow) {
+		return workflow, nil
+	}
+	return filepath.Join(filepath.Dir(styleFile), workflow), nil
+}
+
+func (c *comfyUIClient) generateImage(ctx context.Context, req imageRequest) (imageResult, error) {
+	path, err := comfyUIWorkflowPath(req.Style, req.StyleFile)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return imageResult{}, fmt.Errorf("read workflow: %w", err)
+	}
+
+	var workflow any
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return imageResult{}, fmt.Errorf("parse workflow %s: %w", path, err)
+	}
+
+	width, height, err := parseSize(req.Size)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	seed := int64(0)
+	if req.Seed != nil {
+		seed = *req.Seed
+	} else {
+		n, err := rand.Int(rand.Reader, big.NewInt(1<<32))
+		if err != nil {
+			return imageResult{}, err
+		}
+		seed = n.Int64()
+	}
+
+	values := map[string]any{
+		"positive_prompt": req.Prompt,
+		"negative_prompt": req.NegativePrompt,
+		"seed":            seed,
+		"width":           width,
+		"height":          height,
+		"model":           req.Model,
+	}
+	for i, ref := range req.References {
+		name, err := c.uploadImage(ctx, ref)
+		if err != nil {
+			return imageResult{}, err
+		}
+		values["reference_image_"+strconv.Itoa(i+1)] = name
+		if i == 0 {
+			values["reference_image"] = name
+		}
+	}
+
+	promptID, err := c.queuePrompt(ctx, substituteComfyUIPlaceholders(workflow, values))
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	image, err := c.waitForImage(ctx, promptID)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	imageBytes, err := c.download(ctx, image)
+	if err != nil {
+		return imageResult{}, err
+	}
+	return imageResult{Image: imageBytes, Seed: &seed}, nil
+}
+
+// comfyUIPlaceholderPattern matches a {{name}} placeholder in a workflow.
+var comfyUIPlaceholderPattern = regexp.MustCompile(`\{\{\s*[A-Za-z0-9_]+\s*\}\}`)
+
+// substituteComfyUIPlaceholders replaces {{name}} placeholders in every
+// string of the workflow. A string that is exactly one placeholder takes
+// the value's type, so "{{seed}}" becomes a number.
+func substituteComfyUIPlaceholders(node any, values map[string]any) any {
+	switch typed := node.(type) {
+	case map[string]any:
+		for key, value := range typed {
+			typed[key] = substituteComfyUIPlaceholders(value, values)
+		}
+		return typed
+	case []any:
+		for i, value := range typed {
+			typed[i] = substituteComfyUIPlaceholders(value, values)
+		}
+		return typed
+	case string:
+		trimmed := strings.TrimSpace(typed)
+		if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") && strings.Count(trimmed, "{{") == 1 {
+			if value, ok := values[strings.TrimSpace(trimmed[2:len(trimmed)-2])]; ok {
+				return value
+			}
+		}
+		// One pass over the original string, so text inserted for one
+		// placeholder (such as a prompt containing "{{seed}}") is never
+		// substituted again.
+		return comfyUIPlaceholderPattern.ReplaceAllStringFunc(typed, func(token string) string {
+			if value, ok := values[strings.TrimSpace(token[2:len(token)-2])]; ok {
+				return fmt.Sprint(value)
+			}
+			return token
+		})
+	default:
+		return node
+	}
+}
+
+func (c *comfyUIClient) queuePrompt(ctx context.Context, workflow any) (string, error) {
+	reqBody, err := json.Marshal(map[string]any{
+		"prompt":    workflow,
+		"client_id": c.clientID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/prompt", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "comfyui", req, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var payload struct {
+		PromptID string `json:"prompt_id"`
+		Error    *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Details string `json:"details"`
+		} `json:"error,omitempty"`
+		NodeErrors map[string]any `json:"node_errors,omitempty"`
+	}
+	decodeErr := json.Unmarshal(respBody, &payload)
+
+	if resp.StatusCode >= 400 {
+		statusErr := &statusError{Provider: "comfyui", StatusCode: resp.StatusCode}
+		if payload.Error != nil {
+			statusErr.Message = strings.TrimSpace(payload.Error.Message + " " + payload.Error.Details)
+		}
+		if len(payload.NodeErrors) > 0 {
+			if data, err := json.Marshal(payload.NodeErrors); err == nil {
+				statusErr.Message += " node_errors: " + string(data)
+			}
+		}
+		return "", statusErr
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("decode response: %w", decodeErr)
+	}
+	if payload.PromptID == "" {
+		return "", errors.New("comfyui response did not include prompt_id")
+	}
+	return payload.PromptID, nil
+}
+
+func (c *comfyUIClient) waitForImage(ctx context.Context, promptID string) (comfyUIImageRef, error) {
+	ctx, cancel := context.WithTimeout(ctx, comfyUITimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(comfyUIPollInterval)
+	defer ticker.Stop()
+
+	for {
+		entry, done, err := c.history(ctx, promptID)
+		if err != nil {
+			return comfyUIImageRef{}, err
+		}
+		if done {
+			if entry.Status.StatusStr == "error" {
+				return comfyUIImageRef{}, fmt.Errorf("comfyui workflow failed: %s", comfyUIErrorMessage(entry))
+			}
+			return firstComfyUIImage(entry)
+		}
+
+		select {
+		case <-ctx.Done():
+			return comfyUIImageRef{}, fmt.Errorf("waiting for comfyui prompt %s: %w", promptID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *comfyUIClient) history(ctx context.Context, promptID string) (comfyUIHistoryEntry, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/history/"+neturl.PathEscape(promptID), nil)
+	if err != nil {
+		return comfyUIHistoryEntry{}, false, err
+	}
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "comfyui", req, nil)
+	if err != nil {
+		return comfyUIHistoryEntry{}, false, err
+	}
+	if resp.StatusCode >= 400 {
+		return comfyUIHistoryEntry{}, false, &statusError{Provider: "comfyui", StatusCode: resp.StatusCode}
+	}
+
+	var history map[string]comfyUIHistoryEntry
+	if err := json.Unmarshal(respBody, &history); err != nil {
+		return comfyUIHistoryEntry{}, false, fmt.Errorf("decode history: %w", err)
+	}
+
+	entry, ok := history[promptID]
+	if !ok {
+		return comfyUIHistoryEntry{}, false, nil
+	}
+	return entry, entry.Status.Completed || entry.Status.StatusStr == "error", nil
+}
+
+func firstComfyUIImage(entry comfyUIHistoryEntry) (comfyUIImageRef, error) {
+	nodeIDs := make([]string, 0, len(entry.Outputs))
+	for id := range entry.Outputs {
+		nodeIDs = append(nodeIDs, id)
+	}
+	sort.Strings(nodeIDs)
+
+	// Prefer saved outputs over previews from intermediate nodes.
+	var fallback *comfyUIImageRef
+	for _, id := range nodeIDs {
+		for _, image := range entry.Outputs[id].Images {
+			if image.Type == "output" {
+				return image, nil
+			}
+			if fallback == nil {
+				image := image
+				fallback = &image
+			}
+		}
+	}
+	if fallback != nil {
+		return *fallback, nil
+	}
+	return comfyUIImageRef{}, errors.New("comfyui workflow produced no images")
+}
+
+func comfyUIErrorMessage(entry comfyUIHistoryEntry) string {
+	for _, raw := range entry.Status.Messages {
+		var message []json.RawMessage
+		if json.Unmarshal(raw, &message) != nil || len(message) != 2 {
+			continue
+		}
+		var kind string
+		if json.Unmarshal(message[0], &kind) != nil || kind != "execution_error" {
+			continue
+		}
+		var detail struct {
+			NodeType         string `json:"node_type"`
+			ExceptionMessage string `json:"exception_message"`
+		}
+		if json.Unmarshal(message[1], &detail) == nil && detail.ExceptionMessage != "" {
+			return fmt.Sprintf("%s: %s", detail.NodeType, strings.TrimSpace(detail.ExceptionMessage))
+		}
+	}
+	return "execution error"
+}
+
+func (c *comfyUIClient) download(ctx context.Context, image comfyUIImageRef) ([]byte, error) {
+	query := neturl.Values{}
+	query.Set("filename", image.Filename)
+	query.Set("subfolder", image.Subfolder)
+	query.Set("type", image.Type)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/view?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.logger.Debug("provider image download", "provider", "comfyui", "status", resp.StatusCode, "latency", time.Since(start))
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// uploadImage stores a reference image in ComfyUI's input folder and
+// returns the name LoadImage nodes refer to.
+func (c *comfyUIClient) uploadImage(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read reference image: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("image", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.WriteField("overwrite", "true"); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/upload/image", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "comfyui", req, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", &statusError{Provider: "comfyui", StatusCode: resp.StatusCode, Message: "upload " + filepath.Base(path) + " failed"}
+	}
+
+	var uploaded struct {
+		Name      string `json:"name"`
+		Subfolder string `json:"subfolder"`
+	}
+	if err := json.Unmarshal(respBody, &uploaded); err != nil {
+		return "", fmt.Errorf("decode upload response: %w", err)
+	}
+	if uploaded.Subfolder != "" {
+		return uploaded.Subfolder + "/" + uploaded.Name, nil
+	}
+	return uploaded.Name, nil
+}
@@ -0,0 +1,40 @@
+package warhol
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSubstituteComfyUIPlaceholders(t *testing.T) {
+	var workflow any
+	err := json.Unmarshal([]byte(`{
+		"3": {"inputs": {"seed": "{{seed}}", "width": "{{ width }}", "ckpt": "{{model}}.safetensors"}},
+		"6": {"inputs": {"text": "{{positive_prompt}}, masterpiece"}},
+		"7": {"inputs": {"text": "{{negative_prompt}}"}},
+		"9": {"inputs": {"filename_prefix": "warhol_{{unknown}}"}}
+	}`), &workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The prompt holds placeholder tokens of its own, which must reach
+	// ComfyUI verbatim instead of being expanded in a second pass.
+	got := substituteComfyUIPlaceholders(workflow, map[string]any{
+		"positive_prompt": "a sign reading {{negative_prompt}} and {{seed}}",
+		"negative_prompt": "blurry",
+		"seed":            int64(42),
+		"width":           1024,
+		"model":           "sdxl",
+	})
+
+	want := map[string]any{
+		"3": map[string]any{"inputs": map[string]any{"seed": int64(42), "width": 1024, "ckpt": "sdxl.safetensors"}},
+		"6": map[string]any{"inputs": map[string]any{"text": "a sign reading {{negative_prompt}} and {{seed}}, masterpiece"}},
+		"7": map[string]any{"inputs": map[string]any{"text": "blurry"}},
+		"9": map[string]any{"inputs": map[string]any{"filename_prefix": "warhol_{{unknown}}"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("workflow = %v, want %v", got, want)
+	}
+}
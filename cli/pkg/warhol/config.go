@@ -0,0 +1,68 @@
+package warhol
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Config holds settings from the user config file and the project's
+// warhol.yaml. Project values override user values.
+type Config struct {
+	Fallback   []string                   `yaml:"fallback"`
+	Pricing    map[string]ModelPricing    `yaml:"pricing"`
+	Budget     *BudgetConfig              `yaml:"budget"`
+	RateLimits map[string]RateLimitConfig `yaml:"rate_limits"`
+}
+
+// ConfigPaths are the config files LoadConfig reads, in order: the user
+// config, then warhol.yaml in projectDir. Later files win.
+func ConfigPaths(projectDir string) []string {
+	paths := make([]string, 0, 2)
+	if dir, err := ConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "config.yaml"))
+	}
+	return append(paths, filepath.Join(projectDir, "warhol.yaml"))
+}
+
+// LoadConfig reads every existing config file and returns the merged
+// config together with the files that were read. projectDir is the
+// project root; "" means the working directory.
+func LoadConfig(projectDir string) (Config, []string, error) {
+	var cfg Config
+	loaded := make([]string, 0, 2)
+	for _, path := range ConfigPaths(projectDir) {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		var fileCfg Config
+		if err := loadYAML(path, &fileCfg); err != nil {
+			return Config{}, loaded, err
+		}
+		cfg.merge(fileCfg)
+		loaded = append(loaded, path)
+	}
+	return cfg, loaded, nil
+}
+
+func (c *Config) merge(other Config) {
+	if other.Fallback != nil {
+		c.Fallback = other.Fallback
+	}
+	if other.Budget != nil {
+		c.Budget = other.Budget
+	}
+	for model, pricing := range other.Pricing {
+		if c.Pricing == nil {
+			c.Pricing = make(map[string]ModelPricing)
+		}
+		c.Pricing[model] = pricing
+	}
+	for key, limit := range other.RateLimits {
+		if c.RateLimits == nil {
+			c.RateLimits = make(map[string]RateLimitConfig)
+		}
+		c.RateLimits[key] = limit
+	}
+}
@@ -0,0 +1,181 @@
+package warhol
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type storedCredentials struct {
+	Providers map[string]storedCredential `yaml:"providers"`
+}
+
+type storedCredential struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// CredentialProviders are the providers that need an API key.
+var CredentialProviders = []string{"google", "openai"}
+
+// APIKeyEnv returns the environment variables checked for provider's API
+// key, in order of precedence.
+func APIKeyEnv(provider string) []string {
+	switch provider {
+	case "google":
+		return []string{"GEMINI_API_KEY", "GOOGLE_API_KEY"}
+	case "openai":
+		return []string{"OPENAI_API_KEY"}
+	default:
+		return nil
+	}
+}
+
+// ConfigDir is where warhol keeps its user config and credentials:
+// $WARHOL_CONFIG_DIR, or warhol under the user config directory.
+func ConfigDir() (string, error) {
+	if dir := strings.TrimSpace(os.Getenv("WARHOL_CONFIG_DIR")); dir != "" {
+		return dir, nil
+	}
+
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "warhol"), nil
+}
+
+// CredentialsPath is the file that stores API keys saved by
+// `warhol auth login`.
+func CredentialsPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials.yaml"), nil
+}
+
+func loadCredentials() (storedCredentials, error) {
+	creds := storedCredentials{Providers: map[string]storedCredential{}}
+
+	path, err := CredentialsPath()
+	if err != nil {
+		return creds, err
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err := loadYAML(path, &creds); err != nil {
+		return creds, err
+	}
+	if creds.Providers == nil {
+		creds.Providers = map[string]storedCredential{}
+	}
+	return creds, nil
+}
+
+func saveCredentials(creds storedCredentials) error {
+	path, err := CredentialsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, so tighten it explicitly.
+	return os.Chmod(path, 0o600)
+}
+
+// ResolveAPIKey returns the key for provider and where it came from.
+// Environment variables take precedence over the credentials file.
+func ResolveAPIKey(provider string) (string, string, error) {
+	for _, name := range APIKeyEnv(provider) {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value, "env " + name, nil
+		}
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return "", "", err
+	}
+	if value := strings.TrimSpace(creds.Providers[provider].APIKey); value != "" {
+		path, _ := CredentialsPath()
+		return value, path, nil
+	}
+
+	return "", "", nil
+}
+
+func missingKeyError(provider string) error {
+	names := APIKeyEnv(provider)
+	if len(names) == 0 {
+		return fmt.Errorf("unsupported provider %q", provider)
+	}
+
+	required := names[0]
+	if len(names) > 1 {
+		required = fmt.Sprintf("%s (or %s)", names[0], strings.Join(names[1:], ", "))
+	}
+	return fmt.Errorf("%s is required; run `warhol auth login --provider %s` to store one", required, provider)
+}
+
+// RequireAPIKey is ResolveAPIKey that fails when no key is configured.
+func RequireAPIKey(provider string) (string, error) {
+	key, _, err := ResolveAPIKey(provider)
+	if err != nil {
+		return "", fmt.Errorf("read credentials: %w", err)
+	}
+	if key == "" {
+		return "", missingKeyError(provider)
+	}
+	return key, nil
+}
+
+// StoreAPIKey saves key for provider in the credentials file.
+func StoreAPIKey(provider string, key string) error {
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	creds.Providers[provider] = storedCredential{APIKey: key}
+	return saveCredentials(creds)
+}
+
+// RemoveAPIKey deletes the stored key for provider and reports whether
+// one existed.
+func RemoveAPIKey(provider string) (bool, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := creds.Providers[provider]; !ok {
+		return false, nil
+	}
+	delete(creds.Providers, provider)
+	return true, saveCredentials(creds)
+}
+
+// IsCredentialProvider reports whether provider needs an API key.
+func IsCredentialProvider(provider string) bool {
+	for _, name := range CredentialProviders {
+		if name == provider {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+// Package warhol generates images in a consistent style. It is the engine
+// behind the warhol CLI: style and character profiles are loaded from YAML,
+// composed into a provider-specific prompt, sent to an image provider, and
+// recorded in a JSON manifest next to the image.
+//
+// A minimal program:
+//
+//	client := warhol.NewClient(warhol.Options{OutDir: "outputs"})
+//	result, err := client.Generate(ctx, warhol.Request{
+//		Style:     "16bit",
+//		Character: "matt",
+//		Prompt:    "full body portrait, city street at night",
+//	})
+//	if err != nil {
+//		log.Fatal(warhol.Describe(err).Message)
+//	}
+//	fmt.Println(result.ImagePath)
+//
+// API keys are read from the environment (GEMINI_API_KEY, OPENAI_API_KEY)
+// or from credentials saved by `warhol auth login`. Errors returned by a
+// Client carry an ErrorCode; use CodeOf or Describe to inspect them.
+//
+// Manifest and the types it embeds are written to disk as JSON; their
+// field names are part of the stable API and change only additively.
+package warhol
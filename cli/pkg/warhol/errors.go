@@ -0,0 +1,76 @@
+package warhol
+
+import (
+	"errors"
+)
+
+// ErrorCode classifies a failure. The CLI reports it as error.code in JSON
+// output and maps it to exit statuses and HTTP responses.
+type ErrorCode string
+
+// Error codes reported by the SDK and the CLI.
+const (
+	CodeUsage         ErrorCode = "usage"
+	CodeAuth          ErrorCode = "auth"
+	CodeProfile       ErrorCode = "profile"
+	CodeProvider      ErrorCode = "provider"
+	CodeContentPolicy ErrorCode = "content_policy"
+	CodeBudget        ErrorCode = "budget"
+	CodeRejected      ErrorCode = "rejected"
+	CodeIO            ErrorCode = "io"
+	CodeInternal      ErrorCode = "internal"
+)
+
+// Error tags an error with its code. Errors returned by a Client carry
+// one; use CodeOf or Describe rather than asserting the type.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// WithCode tags err with code. It returns nil for a nil err.
+func WithCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code err was tagged with, or CodeInternal.
+func CodeOf(err error) ErrorCode {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return CodeInternal
+}
+
+// ErrorDetail is the JSON form of an error, as recorded in manifests.
+type ErrorDetail struct {
+	Code         ErrorCode `json:"code"`
+	Message      string    `json:"message"`
+	Category     string    `json:"category,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Retryable    bool      `json:"retryable,omitempty"`
+	ManifestPath string    `json:"manifest_path,omitempty"`
+}
+
+// Describe returns the detail of err, including the category and reason
+// of content policy refusals.
+func Describe(err error) ErrorDetail {
+	detail := ErrorDetail{
+		Code:      CodeOf(err),
+		Message:   err.Error(),
+		Retryable: isRetryable(err),
+	}
+
+	var policy *contentPolicyError
+	if errors.As(err, &policy) {
+		detail.Category = policy.Category
+		detail.Reason = policy.Reason
+	}
+	return detail
+}
@@ -0,0 +1,39 @@
+//go:build !unix
+
+package warhol
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockStaleAfter is how old a lock file must be before it is assumed to
+// belong to a crashed process.
+const lockStaleAfter = 30 * time.Second
+
+// lockFile takes an exclusive lock by creating path, waiting for other
+// processes to remove it. The returned function releases the lock.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(2 * lockStaleAfter)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,627 @@
+package warhol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Manifest describes one generation. It is written as JSON next to the
+// image, and also for dry runs and failures.
+type Manifest struct {
+	CreatedAt         string            `json:"created_at"`
+	Provider          string            `json:"provider"`
+	Model             string            `json:"model"`
+	Size              string            `json:"size,omitempty"`
+	AspectRatio       string            `json:"aspect_ratio,omitempty"`
+	Quality           string            `json:"quality,omitempty"`
+	StyleInput        string            `json:"style_input"`
+	StyleFile         string            `json:"style_file"`
+	Character         string            `json:"character,omitempty"`
+	CharacterFile     string            `json:"character_file,omitempty"`
+	Prompt            string            `json:"prompt"`
+	Wildcards         *Wildcards        `json:"wildcards,omitempty"`
+	Location          string            `json:"location,omitempty"`
+	Vars              map[string]string `json:"vars,omitempty"`
+	FinalPrompt       string            `json:"final_prompt"`
+	NegativePrompt    string            `json:"negative_prompt,omitempty"`
+	SystemInstruction string            `json:"system_instruction,omitempty"`
+	Composition       *Composition      `json:"composition,omitempty"`
+	Seed              *int64            `json:"seed,omitempty"`
+	References        []string          `json:"references,omitempty"`
+	ImagePath         string            `json:"image_path,omitempty"`
+	DryRun            bool              `json:"dry_run"`
+	Status            string            `json:"status"`
+	Error             *ErrorDetail      `json:"error,omitempty"`
+	Attempts          []Attempt         `json:"attempts,omitempty"`
+	Usage             *Usage            `json:"usage,omitempty"`
+	Cache             *CacheInfo        `json:"cache,omitempty"`
+	Score             *Score            `json:"score,omitempty"`
+}
+
+// Attempt records one provider call of a fallback chain.
+type Attempt struct {
+	Provider   string       `json:"provider"`
+	Model      string       `json:"model"`
+	Status     string       `json:"status"`
+	DurationMS int64        `json:"duration_ms"`
+	WaitMS     int64        `json:"rate_limit_wait_ms,omitempty"`
+	Error      *ErrorDetail `json:"error,omitempty"`
+}
+
+type generateOptions struct {
+	Style     string
+	Character string
+	Prompt    string
+	Location  string
+	Vars      map[string]string
+	Wildcards *Wildcards
+	Roots     profileRoots
+	OutDir    string
+	Provider  string
+	Model     string
+	Size      string
+	Aspect    string
+	Quality   string
+	DryRun    bool
+	Refs      []string
+	Fallback  []string
+	Pricing   map[string]ModelPricing
+	Cache     bool
+	// Score enables style scoring, as does a MinScore above zero.
+	// MinScore defaults to the style's score_threshold; rejected images
+	// are regenerated up to MaxRejects times.
+	Score      bool
+	MinScore   float64
+	MaxRejects int
+}
+
+// providerTarget is one provider of a fallback chain with its model.
+type providerTarget struct {
+	Provider string
+	Model    string
+	Geometry providerGeometry
+}
+
+// generationJob is a generation whose profiles are loaded and prompt is
+// composed, ready to be sent to the provider.
+type generationJob struct {
+	opts        generateOptions
+	logger      *slog.Logger
+	style       Style
+	character   *Character
+	targets     []providerTarget
+	manifest    Manifest
+	startedAt   time.Time
+	composed    Composition
+	composeTime time.Duration
+	seedOffset  int64
+	budget      *budgetTracker
+	limiters    *rateLimiters
+	scorer      *Scorer
+	seedStride  int64
+}
+
+// Result is the outcome of one generation.
+type Result struct {
+	Manifest     Manifest `json:"manifest"`
+	ManifestPath string   `json:"manifest_path"`
+	ImagePath    string   `json:"image_path,omitempty"`
+	Timings      Timings  `json:"timings"`
+}
+
+// BatchResult is the outcome of GenerateBatch.
+type BatchResult struct {
+	Results          []Result         `json:"results"`
+	Succeeded        int              `json:"succeeded"`
+	Failed           int              `json:"failed"`
+	EstimatedCostUSD float64          `json:"estimated_cost_usd"`
+	RateLimitWaitMS  int64            `json:"rate_limit_wait_ms"`
+	RateLimitWaits   map[string]int64 `json:"rate_limit_waits_ms,omitempty"`
+}
+
+// Timings break down how long a generation took.
+type Timings struct {
+	ComposeMS  int64 `json:"compose_ms"`
+	GenerateMS int64 `json:"generate_ms"`
+	TotalMS    int64 `json:"total_ms"`
+	// RateLimitWaitMS is time spent waiting on client-side rate limits,
+	// included in GenerateMS. RateLimitWaits splits it by rate_limits key.
+	RateLimitWaitMS int64            `json:"rate_limit_wait_ms,omitempty"`
+	RateLimitWaits  map[string]int64 `json:"rate_limit_waits_ms,omitempty"`
+}
+
+func prepareGeneration(logger *slog.Logger, opts generateOptions) (*generationJob, error) {
+	startedAt := time.Now()
+
+	style, stylePath, err := opts.Roots.loadStyle(opts.Style)
+	if err != nil {
+		return nil, WithCode(CodeProfile, fmt.Errorf("failed to load style profile: %w", err))
+	}
+	if err := validateScoreThreshold(style); err != nil {
+		return nil, WithCode(CodeProfile, fmt.Errorf("invalid style profile %s: %w", stylePath, err))
+	}
+
+	var character *Character
+	characterPath := ""
+	if opts.Character != "" {
+		loadedCharacter, resolvedPath, err := opts.Roots.loadCharacter(opts.Character)
+		if err != nil {
+			return nil, WithCode(CodeProfile, fmt.Errorf("failed to load character profile: %w", err))
+		}
+		character = &loadedCharacter
+		characterPath = resolvedPath
+	}
+
+	for _, ref := range opts.Refs {
+		if _, err := os.Stat(ref); err != nil {
+			return nil, WithCode(CodeUsage, fmt.Errorf("reference image: %w", err))
+		}
+	}
+
+	targets, err := resolveProviderChain(opts.Roots, opts.Provider, opts.Model, opts.Fallback)
+	if err != nil {
+		return nil, WithCode(CodeUsage, fmt.Errorf("invalid model/provider: %w", err))
+	}
+	for i, target := range targets {
+		geometry, err := resolveGeometry(target.Provider, target.Model, opts.Aspect, opts.Size)
+		if err != nil {
+			return nil, WithCode(CodeUsage, err)
+		}
+		if geometry.Warning != "" {
+			logger.Warn(geometry.Warning, "provider", target.Provider, "model", target.Model)
+		}
+		targets[i].Geometry = geometry
+
+		if target.Provider != "comfyui" {
+			continue
+		}
+		workflow, err := comfyUIWorkflowPath(style, stylePath)
+		if err != nil {
+			return nil, WithCode(CodeProfile, fmt.Errorf("comfyui provider: %w", err))
+		}
+		if _, err := os.Stat(workflow); err != nil {
+			return nil, WithCode(CodeProfile, fmt.Errorf("comfyui workflow: %w", err))
+		}
+	}
+
+	job := &generationJob{
+		opts:      opts,
+		logger:    logger,
+		style:     style,
+		character: character,
+		targets:   targets,
+		startedAt: startedAt,
+	}
+	if len(opts.Vars) > 0 && style.PromptTemplate == "" {
+		logger.Warn("style has no prompt_template; vars are ignored", "style", stylePath)
+	}
+	if job.composed, err = composePrompt(style, character, opts); err != nil {
+		return nil, err
+	}
+	job.composed.AspectRatio = opts.Aspect
+	job.manifest = Manifest{
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		StyleInput:    opts.Style,
+		StyleFile:     stylePath,
+		Prompt:        opts.Prompt,
+		Location:      opts.Location,
+		Vars:          opts.Vars,
+		Wildcards:     opts.Wildcards,
+		References:    opts.Refs,
+		DryRun:        opts.DryRun,
+		Character:     opts.Character,
+		CharacterFile: characterPath,
+		Composition:   &job.composed,
+	}
+	if opts.Score || opts.MinScore > 0 {
+		threshold := opts.MinScore
+		if threshold == 0 {
+			threshold = style.ScoreThreshold
+		}
+		if job.scorer, err = NewScorer(style, stylePath, threshold); err != nil {
+			return nil, WithCode(CodeProfile, err)
+		}
+	}
+
+	job.manifest = job.manifestFor(targets[0])
+	job.composeTime = time.Since(startedAt)
+
+	logger.Debug("prompt composed", "style", stylePath, "character", characterPath, "provider", targets[0].Provider, "model", targets[0].Model)
+	return job, nil
+}
+
+// manifestFor returns the job's manifest with the prompt and parameters
+// composed for target.
+func (j *generationJob) manifestFor(target providerTarget) Manifest {
+	manifest := j.manifest
+	manifest.Provider = target.Provider
+	manifest.Model = target.Model
+	rendered := renderPrompt(j.opts.Roots, target.Provider, j.composed)
+	manifest.FinalPrompt = rendered.Prompt
+	manifest.NegativePrompt = rendered.NegativePrompt
+	manifest.SystemInstruction = rendered.SystemInstruction
+	manifest.Size = target.Geometry.Size
+	manifest.AspectRatio = target.Geometry.AspectRatio
+	manifest.Quality = ""
+	manifest.Seed = nil
+
+	switch target.Provider {
+	case "google":
+	case "openai":
+		manifest.Quality = j.opts.Quality
+	default:
+		if seed := j.composed.Seed; seed != nil {
+			// Batches step fixed seeds so each image differs reproducibly.
+			offset := *seed + j.seedOffset
+			manifest.Seed = &offset
+		}
+	}
+	return manifest
+}
+
+func (j *generationJob) run(ctx context.Context) (Result, error) {
+	result := Result{}
+
+	if err := os.MkdirAll(j.opts.OutDir, 0o755); err != nil {
+		return result, WithCode(CodeIO, fmt.Errorf("failed to create output directory: %w", err))
+	}
+
+	stem, err := reserveOutputStem(j.opts.OutDir, time.Now().UTC())
+	if err != nil {
+		return result, WithCode(CodeIO, fmt.Errorf("failed to reserve output name: %w", err))
+	}
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	manifest := j.manifestFor(j.targets[0])
+	manifest.CreatedAt = createdAt
+	imagePath := filepath.Join(j.opts.OutDir, "image-"+stem+".png")
+	manifestPath := filepath.Join(j.opts.OutDir, "manifest-"+stem+".json")
+	generateStart := time.Now()
+	if j.opts.DryRun {
+		manifest.Status = "dry_run"
+	} else {
+		var generated imageResult
+		var err error
+		manifest, generated, err = j.generateWithFallback(ctx)
+		manifest.CreatedAt = createdAt
+		if err != nil {
+			err = WithCode(providerErrorCode(err), fmt.Errorf("image generation failed: %w", err))
+			detail := Describe(err)
+			manifest.Status = "failed"
+			manifest.Error = &detail
+			if writeErr := WriteManifest(manifestPath, manifest); writeErr != nil {
+				j.logger.Warn("failed to write failure manifest", "path", manifestPath, "error", writeErr)
+			} else {
+				result.ManifestPath = manifestPath
+			}
+			result.Manifest = manifest
+			return result, err
+		}
+
+		if generated.Seed != nil {
+			manifest.Seed = generated.Seed
+		}
+		if err := os.WriteFile(imagePath, generated.Image, 0o644); err != nil {
+			os.Remove(manifestPath)
+			return result, WithCode(CodeIO, fmt.Errorf("failed to write image: %w", err))
+		}
+
+		manifest.ImagePath = imagePath
+		manifest.Status = "succeeded"
+		if j.scorer != nil {
+			score, err := j.scorer.scoreBytes(generated.Image)
+			if err != nil {
+				j.logger.Warn("failed to score image", "path", imagePath, "error", err)
+			} else {
+				manifest.Score = &score
+				if score.Passed != nil && !*score.Passed {
+					manifest.Status = "rejected"
+				}
+			}
+		}
+	}
+	generateElapsed := time.Since(generateStart)
+
+	if err := WriteManifest(manifestPath, manifest); err != nil {
+		return result, err
+	}
+
+	result.Manifest = manifest
+	result.ManifestPath = manifestPath
+	result.ImagePath = manifest.ImagePath
+	result.Timings = Timings{
+		ComposeMS:  j.composeTime.Milliseconds(),
+		GenerateMS: generateElapsed.Milliseconds(),
+		TotalMS:    time.Since(j.startedAt).Milliseconds(),
+	}
+	for _, attempt := range manifest.Attempts {
+		if attempt.WaitMS == 0 {
+			continue
+		}
+		if result.Timings.RateLimitWaits == nil {
+			result.Timings.RateLimitWaits = map[string]int64{}
+		}
+		result.Timings.RateLimitWaitMS += attempt.WaitMS
+		result.Timings.RateLimitWaits[j.limiters.keyFor(attempt.Provider, attempt.Model)] += attempt.WaitMS
+	}
+	if manifest.Status == "rejected" {
+		return result, WithCode(CodeRejected, fmt.Errorf("style score %.3f is below threshold %.3f", manifest.Score.Score, manifest.Score.Threshold))
+	}
+	return result, nil
+}
+
+// runWithRejects runs the job and regenerates while the style score
+// rejects the image, up to MaxRejects times. Fixed seeds advance by one
+// batch stride per retry so retries never repeat another image's seed.
+func (j *generationJob) runWithRejects(ctx context.Context) (Result, error) {
+	item := *j
+	for rejects := 0; ; rejects++ {
+		result, err := item.run(ctx)
+		if CodeOf(err) != CodeRejected || rejects >= j.opts.MaxRejects {
+			return result, err
+		}
+		j.logger.Warn("image rejected by style score, regenerating", "path", result.ImagePath, "score", result.Manifest.Score.Score, "retry", rejects+1)
+		item.seedOffset += max(j.seedStride, 1)
+	}
+}
+
+// generateWithFallback tries each provider target in order, moving on
+// after retryable or content policy failures. The returned manifest
+// describes the last attempt and lists every attempt made.
+func (j *generationJob) generateWithFallback(ctx context.Context) (Manifest, imageResult, error) {
+	attempts := make([]Attempt, 0, len(j.targets))
+	var manifest Manifest
+	var lastErr error
+	for i, target := range j.targets {
+		manifest = j.manifestFor(target)
+
+		start := time.Now()
+		generated, waited, err := j.callProvider(ctx, manifest)
+		attempt := Attempt{
+			Provider:   target.Provider,
+			Model:      target.Model,
+			DurationMS: time.Since(start).Milliseconds(),
+			WaitMS:     waited.Milliseconds(),
+			Status:     "succeeded",
+		}
+		if err != nil {
+			detail := Describe(WithCode(providerErrorCode(err), err))
+			attempt.Status = "failed"
+			attempt.Error = &detail
+		}
+		attempts = append(attempts, attempt)
+		manifest.Attempts = attempts
+
+		if err == nil {
+			manifest.Usage = generated.Usage
+			manifest.Cache = generated.Cache
+			return manifest, generated, nil
+		}
+
+		lastErr = err
+		if i == len(j.targets)-1 || !shouldFallback(err) {
+			break
+		}
+		j.logger.Warn("provider failed, trying next", "provider", target.Provider, "next", j.targets[i+1].Provider, "error", err)
+	}
+	return manifest, imageResult{}, lastErr
+}
+
+// callProvider generates one image within the rate limit and budget,
+// recording the call's estimated cost in generated.Usage. Cache hits skip
+// the provider entirely. It also returns the time spent waiting on the
+// rate limiter.
+func (j *generationJob) callProvider(ctx context.Context, manifest Manifest) (imageResult, time.Duration, error) {
+	cache, key := j.cacheLookupKey(manifest)
+	if cache != "" {
+		if image, entry, ok := lookupCache(cache, key); ok {
+			j.logger.Debug("cache hit", "provider", manifest.Provider, "model", manifest.Model, "key", key)
+			return imageResult{Image: image, Seed: entry.Seed, Cache: &CacheInfo{Key: key, Hit: true}}, 0, nil
+		}
+	}
+
+	limiter := j.limiters.forTarget(manifest.Provider, manifest.Model)
+	waited, err := limiter.wait(ctx)
+	if err != nil {
+		return imageResult{}, waited, err
+	}
+	if waited > 0 {
+		j.logger.Debug("rate limited", "provider", manifest.Provider, "model", manifest.Model, "wait_ms", waited.Milliseconds())
+	}
+
+	var reservation budgetReservation
+	if j.budget != nil {
+		reservation, err = j.budget.reserve(manifest.Provider, manifest.Model, manifest.Quality)
+		if err != nil {
+			return imageResult{}, waited, err
+		}
+	}
+
+	generated, err := j.generateImage(ctx, manifest)
+	limiter.observe(err)
+	if err == nil {
+		generated.Usage = estimateCost(j.opts.Pricing, manifest.Provider, manifest.Model, manifest.Quality, generated.Usage)
+	}
+	if j.budget != nil {
+		j.budget.settle(reservation, generated.Usage, err != nil)
+	}
+
+	if err == nil && cache != "" {
+		entry := CacheEntry{Key: key, Provider: manifest.Provider, Model: manifest.Model, Prompt: manifest.FinalPrompt, Seed: generated.Seed}
+		if storeErr := storeCache(cache, entry, generated.Image); storeErr != nil {
+			j.logger.Warn("failed to cache image", "key", key, "error", storeErr)
+		} else {
+			generated.Cache = &CacheInfo{Key: key}
+		}
+	}
+	return generated, waited, err
+}
+
+// cacheLookupKey returns the cache directory and key for manifest, or an
+// empty directory when caching is off or unavailable.
+func (j *generationJob) cacheLookupKey(manifest Manifest) (string, string) {
+	if !j.opts.Cache {
+		return "", ""
+	}
+
+	dir, err := CacheDir()
+	if err != nil {
+		j.logger.Warn("generation cache unavailable", "error", err)
+		return "", ""
+	}
+	key, err := j.cacheKey(manifest)
+	if err != nil {
+		j.logger.Warn("generation cache unavailable", "error", err)
+		return "", ""
+	}
+	return dir, key
+}
+
+func shouldFallback(err error) bool {
+	var policy *contentPolicyError
+	return isRetryable(err) || errors.As(err, &policy)
+}
+
+// reserveOutputStem returns a timestamp-based name for the next image and
+// manifest in dir. The manifest file is created exclusively so concurrent
+// generations never share a name; a numeric suffix is added on collision.
+func reserveOutputStem(dir string, now time.Time) (string, error) {
+	ts := now.Format("20060102-150405")
+	for n := 1; ; n++ {
+		stem := ts
+		if n > 1 {
+			stem = fmt.Sprintf("%s-%d", ts, n)
+		}
+
+		file, err := os.OpenFile(filepath.Join(dir, "manifest-"+stem+".json"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return stem, file.Close()
+	}
+}
+
+// WriteManifest writes manifest to path as indented JSON.
+func WriteManifest(path string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return WithCode(CodeInternal, fmt.Errorf("failed to encode manifest: %w", err))
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return WithCode(CodeIO, fmt.Errorf("failed to write metadata: %w", err))
+	}
+	return nil
+}
+
+func providerErrorCode(err error) ErrorCode {
+	var budget *budgetError
+	if errors.As(err, &budget) {
+		return CodeBudget
+	}
+	var policy *contentPolicyError
+	if errors.As(err, &policy) {
+		return CodeContentPolicy
+	}
+	return CodeProvider
+}
+
+// resolveProviderChain parses --provider values such as "google,openai" or
+// "google:gemini-2.5-flash-image,sd". The model override applies to the
+// first provider; the config fallback list is only used when a single
+// provider is given.
+func resolveProviderChain(roots profileRoots, spec string, modelOverride string, fallback []string) ([]providerTarget, error) {
+	entries := strings.Split(strings.ToLower(spec), ",")
+	if len(entries) == 1 {
+		entries = append(entries, fallback...)
+	}
+
+	targets := make([]providerTarget, 0, len(entries))
+	seen := make(map[providerTarget]struct{}, len(entries))
+	for i, entry := range entries {
+		provider, model, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if provider == "" {
+			continue
+		}
+		if i == 0 && model == "" {
+			model = modelOverride
+		}
+
+		resolvedModel, err := resolveModel(roots, provider, model)
+		if err != nil {
+			return nil, err
+		}
+
+		target := providerTarget{Provider: provider, Model: resolvedModel}
+		if _, exists := seen[target]; exists {
+			continue
+		}
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no provider given")
+	}
+	return targets, nil
+}
+
+func resolveModel(roots profileRoots, provider string, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+
+	switch provider {
+	case "google":
+		return "gemini-2.5-flash-image", nil
+	case "openai":
+		return "gpt-image-1", nil
+	case "sd":
+		return defaultSDModel, nil
+	case "comfyui":
+		return defaultComfyUIModel, nil
+	}
+
+	def, _, err := roots.loadQueueProvider(provider)
+	if errors.Is(err, errProfileNotFound) {
+		return "", unsupportedProviderError(provider)
+	}
+	if err != nil {
+		return "", err
+	}
+	if def.DefaultModel == "" {
+		return "default", nil
+	}
+	return def.DefaultModel, nil
+}
+
+func (j *generationJob) generateImage(ctx context.Context, manifest Manifest) (imageResult, error) {
+	provider, err := newImageProvider(j.opts.Roots, manifest.Provider, j.logger)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	return provider.generateImage(ctx, imageRequest{
+		Model:          manifest.Model,
+		Prompt:         manifest.FinalPrompt,
+		NegativePrompt: manifest.NegativePrompt,
+		Instruction:    manifest.SystemInstruction,
+		Seed:           manifest.Seed,
+		Size:           manifest.Size,
+		AspectRatio:    manifest.AspectRatio,
+		Quality:        manifest.Quality,
+		References:     manifest.References,
+		Style:          j.style,
+		StyleFile:      manifest.StyleFile,
+	})
+}
@@ -0,0 +1,163 @@
+package warhol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const defaultImageSize = "1024x1024"
+
+var googleAspectRatios = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// openAISizes lists the sizes each OpenAI image model accepts.
+var openAISizes = map[string][]string{
+	"gpt-image-1": {"1024x1024", "1536x1024", "1024x1536"},
+	"dall-e-3":    {"1024x1024", "1792x1024", "1024x1792"},
+	"dall-e-2":    {"256x256", "512x512", "1024x1024"},
+}
+
+// providerGeometry is the requested shape translated for one provider.
+type providerGeometry struct {
+	AspectRatio string
+	Size        string
+	Warning     string
+}
+
+func parseAspect(aspect string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.TrimSpace(aspect), ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid aspect %q (expected W:H, e.g. 16:9)", aspect)
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect %q (expected W:H, e.g. 16:9)", aspect)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect %q (expected W:H, e.g. 16:9)", aspect)
+	}
+	return width, height, nil
+}
+
+// validateGeometry checks --aspect and --size on their own and against
+// each other, returning the requested width/height ratio (0 if neither
+// was given).
+func validateGeometry(aspect string, size string) (float64, error) {
+	ratio := 0.0
+	if aspect != "" {
+		w, h, err := parseAspect(aspect)
+		if err != nil {
+			return 0, err
+		}
+		ratio = float64(w) / float64(h)
+	}
+
+	if size != "" {
+		w, h, err := parseSize(size)
+		if err != nil {
+			return 0, err
+		}
+		sizeRatio := float64(w) / float64(h)
+		if ratio != 0 && math.Abs(math.Log(sizeRatio/ratio)) > 0.01 {
+			return 0, fmt.Errorf("--aspect %s conflicts with --size %s", aspect, size)
+		}
+		ratio = sizeRatio
+	}
+	return ratio, nil
+}
+
+// resolveGeometry maps the requested aspect and size to what provider and
+// model accept. Google takes an aspect ratio, OpenAI a fixed set of sizes
+// and everything else an explicit width and height.
+func resolveGeometry(provider string, model string, aspect string, size string) (providerGeometry, error) {
+	ratio, err := validateGeometry(aspect, size)
+	if err != nil {
+		return providerGeometry{}, err
+	}
+
+	switch provider {
+	case "google":
+		if ratio == 0 {
+			return providerGeometry{}, nil
+		}
+		if aspect != "" {
+			if !containsFold(googleAspectRatios, aspect) {
+				return providerGeometry{}, fmt.Errorf("google does not support aspect %s (supported: %s)", aspect, strings.Join(googleAspectRatios, ", "))
+			}
+			return providerGeometry{AspectRatio: aspect}, nil
+		}
+
+		nearest := nearestByRatio(googleAspectRatios, ratio, parseAspect)
+		geometry := providerGeometry{AspectRatio: nearest}
+		if w, h, _ := parseAspect(nearest); math.Abs(math.Log(float64(w)/float64(h)/ratio)) > 0.01 {
+			geometry.Warning = fmt.Sprintf("google does not take sizes; using nearest aspect %s for %s", nearest, size)
+		}
+		return geometry, nil
+
+	case "openai":
+		allowed, known := openAISizes[model]
+		if ratio == 0 {
+			return providerGeometry{Size: defaultImageSize}, nil
+		}
+		if !known {
+			if size == "" {
+				return providerGeometry{}, fmt.Errorf("--aspect needs a known size table for openai model %s; pass --size instead", model)
+			}
+			return providerGeometry{Size: size}, nil
+		}
+		if size != "" && containsFold(allowed, size) {
+			return providerGeometry{Size: size}, nil
+		}
+
+		nearest := nearestByRatio(allowed, ratio, parseSize)
+		requested := size
+		if requested == "" {
+			requested = "aspect " + aspect
+		}
+		return providerGeometry{
+			Size:    nearest,
+			Warning: fmt.Sprintf("%s does not support %s; using nearest size %s", model, requested, nearest),
+		}, nil
+
+	default:
+		if size != "" {
+			return providerGeometry{Size: size, AspectRatio: aspect}, nil
+		}
+		if ratio == 0 {
+			return providerGeometry{Size: defaultImageSize}, nil
+		}
+		return providerGeometry{Size: sizeForAspect(ratio, 1024*1024), AspectRatio: aspect}, nil
+	}
+}
+
+// nearestByRatio picks the candidate whose width/height ratio is closest
+// to ratio.
+func nearestByRatio(candidates []string, ratio float64, parse func(string) (int, int, error)) string {
+	best := candidates[0]
+	bestDistance := math.Inf(1)
+	for _, candidate := range candidates {
+		w, h, err := parse(candidate)
+		if err != nil {
+			continue
+		}
+		distance := math.Abs(math.Log(float64(w) / float64(h) / ratio))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// sizeForAspect returns a WIDTHxHEIGHT of roughly area pixels with both
+// sides rounded to multiples of 64, as diffusion models expect.
+func sizeForAspect(ratio float64, area int) string {
+	width := math.Sqrt(float64(area) * ratio)
+	height := width / ratio
+	round := func(v float64) int {
+		return max(64, int(math.Round(v/64))*64)
+	}
+	return fmt.Sprintf("%dx%d", round(width), round(height))
+}
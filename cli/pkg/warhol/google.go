@@ -0,0 +1,268 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultGoogleBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+type googleClient struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+	logger  *slog.Logger
+}
+
+type googleGenerateRequest struct {
+	SystemInstruction *googleContent          `json:"systemInstruction,omitempty"`
+	Contents          []googleContent         `json:"contents"`
+	GenerationConfig  *googleGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type googleGenerationConfig struct {
+	ImageConfig *googleImageConfig `json:"imageConfig,omitempty"`
+}
+
+type googleImageConfig struct {
+	AspectRatio string `json:"aspectRatio,omitempty"`
+}
+
+type googleContent struct {
+	Parts []googlePart `json:"parts"`
+}
+
+type googlePart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *googleInlineData `json:"inlineData,omitempty"`
+}
+
+type googleInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type googleSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability,omitempty"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+type googleGenerateResponse struct {
+	PromptFeedback *struct {
+		BlockReason        string               `json:"blockReason,omitempty"`
+		BlockReasonMessage string               `json:"blockReasonMessage,omitempty"`
+		SafetyRatings      []googleSafetyRating `json:"safetyRatings,omitempty"`
+	} `json:"promptFeedback,omitempty"`
+	Candidates []struct {
+		FinishReason  string               `json:"finishReason,omitempty"`
+		FinishMessage string               `json:"finishMessage,omitempty"`
+		SafetyRatings []googleSafetyRating `json:"safetyRatings,omitempty"`
+		Content       struct {
+			Parts []struct {
+				Text       string `json:"text,omitempty"`
+				InlineData *struct {
+					MimeType string `json:"mimeType,omitempty"`
+					Data     string `json:"data,omitempty"`
+				} `json:"inlineData,omitempty"`
+				InlineDataSnake *struct {
+					MimeType string `json:"mime_type,omitempty"`
+					Data     string `json:"data,omitempty"`
+				} `json:"inline_data,omitempty"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int64 `json:"promptTokenCount"`
+		CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+		TotalTokenCount      int64 `json:"totalTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func newGoogleClient(logger *slog.Logger) (*googleClient, error) {
+	apiKey, err := RequireAPIKey("google")
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimSpace(os.Getenv("GEMINI_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultGoogleBaseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return &googleClient{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 180 * time.Second},
+		logger:  logger,
+	}, nil
+}
+
+func (c *googleClient) generateImage(ctx context.Context, req imageRequest) (imageResult, error) {
+	return c.generate(ctx, req.Model, req.Prompt, req.Instruction, req.AspectRatio, req.References)
+}
+
+func (c *googleClient) generate(ctx context.Context, model string, prompt string, instruction string, aspectRatio string, references []string) (imageResult, error) {
+	parts := []googlePart{{Text: prompt}}
+	images, err := readReferenceImages(references)
+	if err != nil {
+		return imageResult{}, err
+	}
+	for _, image := range images {
+		parts = append(parts, googlePart{InlineData: &googleInlineData{
+			MimeType: http.DetectContentType(image),
+			Data:     base64.StdEncoding.EncodeToString(image),
+		}})
+	}
+
+	request := googleGenerateRequest{
+		Contents: []googleContent{
+			{Parts: parts},
+		},
+	}
+	if aspectRatio != "" {
+		request.GenerationConfig = &googleGenerationConfig{ImageConfig: &googleImageConfig{AspectRatio: aspectRatio}}
+	}
+	if instruction != "" {
+		request.SystemInstruction = &googleContent{Parts: []googlePart{{Text: instruction}}}
+	}
+
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	endpoint := fmt.Sprintf(
+		"%s/models/%s:generateContent?key=%s",
+		c.baseURL,
+		neturl.PathEscape(model),
+		neturl.QueryEscape(c.apiKey),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return imageResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "google", req, reqBody)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	var payload googleGenerateResponse
+	decodeErr := json.Unmarshal(respBody, &payload)
+
+	if resp.StatusCode >= 400 {
+		statusErr := &statusError{Provider: "google", StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header)}
+		if payload.Error != nil {
+			statusErr.Message = payload.Error.Message
+		}
+		return imageResult{}, statusErr
+	}
+
+	if decodeErr != nil {
+		return imageResult{}, fmt.Errorf("decode response: %w", decodeErr)
+	}
+
+	if feedback := payload.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+		return imageResult{}, &contentPolicyError{
+			Provider: "google",
+			Category: blockedCategory(feedback.SafetyRatings),
+			Reason:   feedback.BlockReason,
+			Message:  feedback.BlockReasonMessage,
+		}
+	}
+
+	texts := make([]string, 0, 2)
+	for _, candidate := range payload.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+			data := ""
+			if part.InlineData != nil && part.InlineData.Data != "" {
+				data = part.InlineData.Data
+			} else if part.InlineDataSnake != nil && part.InlineDataSnake.Data != "" {
+				data = part.InlineDataSnake.Data
+			}
+			if data == "" {
+				continue
+			}
+
+			imageBytes, err := decodeBase64Image(data)
+			if err != nil {
+				return imageResult{}, err
+			}
+			result := imageResult{Image: imageBytes}
+			if usage := payload.UsageMetadata; usage != nil {
+				result.Usage = &Usage{
+					InputTokens:  usage.PromptTokenCount,
+					OutputTokens: usage.CandidatesTokenCount,
+					TotalTokens:  usage.TotalTokenCount,
+				}
+			}
+			return result, nil
+		}
+	}
+
+	for _, candidate := range payload.Candidates {
+		if isGooglePolicyReason(candidate.FinishReason) {
+			message := candidate.FinishMessage
+			if message == "" {
+				message = strings.TrimSpace(strings.Join(texts, " "))
+			}
+			return imageResult{}, &contentPolicyError{
+				Provider: "google",
+				Category: blockedCategory(candidate.SafetyRatings),
+				Reason:   candidate.FinishReason,
+				Message:  message,
+			}
+		}
+	}
+
+	// Gemini often answers with a text part (for example a refusal) instead
+	// of an image; surface it rather than discarding it.
+	if text := strings.TrimSpace(strings.Join(texts, " ")); text != "" {
+		return imageResult{}, fmt.Errorf("google response did not include image data; model replied: %q", text)
+	}
+	return imageResult{}, fmt.Errorf("google response did not include image data")
+}
+
+// blockedCategory returns the category that triggered a block, falling
+// back to the highest-risk rating when none is flagged as blocked.
+func blockedCategory(ratings []googleSafetyRating) string {
+	for _, rating := range ratings {
+		if rating.Blocked {
+			return rating.Category
+		}
+	}
+	for _, probability := range []string{"HIGH", "MEDIUM"} {
+		for _, rating := range ratings {
+			if rating.Probability == probability {
+				return rating.Category
+			}
+		}
+	}
+	return ""
+}
+
+func decodeBase64Image(data string) ([]byte, error) {
+	imageBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode image bytes: %w", err)
+	}
+	return imageBytes, nil
+}
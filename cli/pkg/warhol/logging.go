@@ -0,0 +1,121 @@
+package warhol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+const maxLoggedString = 1024
+
+// doTracedRequest sends req and reads the full response body, logging
+// request metadata, status, latency and redacted bodies at debug level.
+func doTracedRequest(client *http.Client, logger *slog.Logger, provider string, req *http.Request, reqBody []byte) (*http.Response, []byte, error) {
+	logger = logger.With("provider", provider)
+	logger.Debug("provider request",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"body", redactBody(reqBody),
+	)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Debug("provider request failed", "error", err, "latency", time.Since(start))
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		logger.Debug("provider response read failed", "status", resp.StatusCode, "error", err, "latency", latency)
+		return resp, nil, err
+	}
+
+	logger.Debug("provider response",
+		"status", resp.StatusCode,
+		"latency", latency,
+		"content_type", resp.Header.Get("Content-Type"),
+		"bytes", len(respBody),
+		"body", redactBody(respBody),
+	)
+	return resp, respBody, nil
+}
+
+func redactURL(u *neturl.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for name := range query {
+		if isSecretName(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// redactBody hides secrets and truncates long strings (usually base64
+// image data) so bodies stay readable in logs.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return truncateForLog(string(body))
+	}
+
+	data, err := json.Marshal(redactValue("", value))
+	if err != nil {
+		return truncateForLog(string(body))
+	}
+	return string(data)
+}
+
+func redactValue(key string, value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		for k, v := range typed {
+			typed[k] = redactValue(k, v)
+		}
+		return typed
+	case []any:
+		for i, v := range typed {
+			typed[i] = redactValue(key, v)
+		}
+		return typed
+	case string:
+		if isSecretName(key) {
+			return "REDACTED"
+		}
+		return truncateForLog(typed)
+	default:
+		return value
+	}
+}
+
+func truncateForLog(value string) string {
+	if len(value) <= maxLoggedString {
+		return value
+	}
+	return fmt.Sprintf("%s...(%d bytes)", value[:maxLoggedString], len(value))
+}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "key", "token", "authorization", "access_token":
+		return true
+	}
+	return strings.Contains(name, "api_key") || strings.Contains(name, "apikey")
+}
@@ -0,0 +1,115 @@
+package warhol
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StoredManifest is a manifest together with the file it was read from.
+type StoredManifest struct {
+	Path     string
+	Manifest Manifest
+}
+
+// ImageFile is the path of the image the manifest describes, or "" if it
+// has none. generate writes each image next to its manifest, so a
+// relative ImagePath, which was relative to the working directory of the
+// run, is looked up in the manifest's directory instead.
+func (stored StoredManifest) ImageFile() string {
+	path := stored.Manifest.ImagePath
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(stored.Path), filepath.Base(path))
+}
+
+// LoadManifests reads every manifest-*.json under dir, oldest first.
+// Unreadable or partially written manifests are skipped.
+func LoadManifests(dir string) ([]StoredManifest, error) {
+	manifests := make([]StoredManifest, 0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		name := entry.Name()
+		if !strings.HasPrefix(name, "manifest-") || filepath.Ext(name) != ".json" {
+			return nil
+		}
+
+		var manifest Manifest
+		if err := ReadManifest(path, &manifest); err != nil {
+			return nil
+		}
+		manifests = append(manifests, StoredManifest{Path: path, Manifest: manifest})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].Manifest.CreatedAt < manifests[j].Manifest.CreatedAt
+	})
+	return manifests, nil
+}
+
+// ReadManifest decodes the manifest at path into manifest.
+func ReadManifest(path string, manifest *Manifest) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, manifest)
+}
+
+// Time is when a manifest was created, or the zero time if the
+// timestamp is missing.
+func (manifest Manifest) Time() time.Time {
+	created, _ := time.Parse(time.RFC3339, manifest.CreatedAt)
+	return created
+}
+
+// StyleName is the style name a manifest was generated with.
+func (manifest Manifest) StyleName() string {
+	if manifest.StyleFile == "" {
+		return manifest.StyleInput
+	}
+	return strings.TrimSuffix(filepath.Base(manifest.StyleFile), filepath.Ext(manifest.StyleFile))
+}
+
+// CharacterName is the character a manifest was generated with,
+// or "" if there was none.
+func (manifest Manifest) CharacterName() string {
+	if manifest.CharacterFile == "" {
+		return strings.TrimPrefix(manifest.Character, "-")
+	}
+	return strings.TrimSuffix(filepath.Base(manifest.CharacterFile), filepath.Ext(manifest.CharacterFile))
+}
+
+// ManifestPathForImage returns the manifest written next to an image by
+// generate, or "" if there is none.
+func ManifestPathForImage(imagePath string) string {
+	base := filepath.Base(imagePath)
+	stem, ok := strings.CutPrefix(strings.TrimSuffix(base, filepath.Ext(base)), "image-")
+	if !ok {
+		return ""
+	}
+	path := filepath.Join(filepath.Dir(imagePath), "manifest-"+stem+".json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
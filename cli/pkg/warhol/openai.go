@@ -0,0 +1,181 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+)
+
+type openAIClient struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+	logger  *slog.Logger
+}
+
+type openAIImageRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	Size           string `json:"size,omitempty"`
+	Quality        string `json:"quality,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+type openAIImageResponse struct {
+	Data []struct {
+		B64JSON string `json:"b64_json"`
+		URL     string `json:"url"`
+	} `json:"data"`
+	Usage *struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+		TotalTokens  int64 `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type,omitempty"`
+		Code    string `json:"code,omitempty"`
+		Param   string `json:"param,omitempty"`
+	} `json:"error,omitempty"`
+}
+
+func newOpenAIClient(logger *slog.Logger) (*openAIClient, error) {
+	apiKey, err := RequireAPIKey("openai")
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return &openAIClient{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 180 * time.Second},
+		logger:  logger,
+	}, nil
+}
+
+func (c *openAIClient) generateImage(ctx context.Context, req imageRequest) (imageResult, error) {
+	if len(req.References) > 0 {
+		return imageResult{}, fmt.Errorf("openai provider does not support reference images")
+	}
+
+	return c.generate(ctx, req.Model, req.Prompt, req.Size, req.Quality)
+}
+
+func (c *openAIClient) generate(ctx context.Context, model string, prompt string, size string, quality string) (imageResult, error) {
+	reqBody, err := json.Marshal(openAIImageRequest{
+		Model:          model,
+		Prompt:         prompt,
+		Size:           size,
+		Quality:        quality,
+		ResponseFormat: "b64_json",
+	})
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/images/generations", bytes.NewReader(reqBody))
+	if err != nil {
+		return imageResult{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "openai", req, reqBody)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	var payload openAIImageResponse
+	decodeErr := json.Unmarshal(respBody, &payload)
+
+	if resp.StatusCode >= 400 {
+		if payload.Error != nil && isOpenAIPolicyCode(payload.Error.Code) {
+			return imageResult{}, &contentPolicyError{
+				Provider: "openai",
+				Category: payload.Error.Type,
+				Reason:   payload.Error.Code,
+				Message:  payload.Error.Message,
+			}
+		}
+
+		statusErr := &statusError{Provider: "openai", StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header)}
+		if payload.Error != nil {
+			statusErr.Message = payload.Error.Message
+		}
+		return imageResult{}, statusErr
+	}
+
+	if decodeErr != nil {
+		return imageResult{}, fmt.Errorf("decode response: %w", decodeErr)
+	}
+
+	if len(payload.Data) == 0 {
+		return imageResult{}, fmt.Errorf("openai response did not include image data")
+	}
+
+	var result imageResult
+	if usage := payload.Usage; usage != nil {
+		result.Usage = &Usage{
+			InputTokens:  usage.InputTokens,
+			OutputTokens: usage.OutputTokens,
+			TotalTokens:  usage.TotalTokens,
+		}
+	}
+
+	switch {
+	case payload.Data[0].B64JSON != "":
+		imageBytes, err := base64.StdEncoding.DecodeString(payload.Data[0].B64JSON)
+		if err != nil {
+			return imageResult{}, fmt.Errorf("decode image bytes: %w", err)
+		}
+		result.Image = imageBytes
+	case payload.Data[0].URL != "":
+		imageBytes, err := c.downloadImage(ctx, payload.Data[0].URL)
+		if err != nil {
+			return imageResult{}, err
+		}
+		result.Image = imageBytes
+	default:
+		return imageResult{}, fmt.Errorf("openai response had no supported image payload")
+	}
+	return result, nil
+}
+
+func (c *openAIClient) downloadImage(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.logger.Debug("provider image download", "provider", "openai", "status", resp.StatusCode, "latency", time.Since(start))
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,100 @@
+package warhol
+
+import (
+	"math"
+)
+
+// Usage is provider-reported token usage with the estimated cost
+// derived from the pricing table.
+type Usage struct {
+	InputTokens      int64   `json:"input_tokens,omitempty"`
+	OutputTokens     int64   `json:"output_tokens,omitempty"`
+	TotalTokens      int64   `json:"total_tokens,omitempty"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+	CostBasis        string  `json:"cost_basis,omitempty"`
+}
+
+// ModelPricing is the price of one model in USD. Token prices win when the
+// provider reports usage; otherwise the per-image price applies.
+type ModelPricing struct {
+	InputPerMillion   float64            `yaml:"input_per_million"`
+	OutputPerMillion  float64            `yaml:"output_per_million"`
+	PerImage          float64            `yaml:"per_image"`
+	PerImageByQuality map[string]float64 `yaml:"per_image_by_quality"`
+}
+
+// defaultPricing holds list prices at the time of writing. Override or
+// extend them with `pricing:` in config.
+var defaultPricing = map[string]ModelPricing{
+	"gemini-2.5-flash-image": {
+		InputPerMillion:  0.30,
+		OutputPerMillion: 30,
+		PerImage:         0.039,
+	},
+	"gpt-image-1": {
+		InputPerMillion:   5,
+		OutputPerMillion:  40,
+		PerImageByQuality: map[string]float64{"low": 0.011, "medium": 0.042, "high": 0.167},
+	},
+	"dall-e-3": {
+		PerImage:          0.04,
+		PerImageByQuality: map[string]float64{"standard": 0.04, "hd": 0.08},
+	},
+	"dall-e-2": {
+		PerImage: 0.02,
+	},
+}
+
+func pricingTable(overrides map[string]ModelPricing) map[string]ModelPricing {
+	table := make(map[string]ModelPricing, len(defaultPricing)+len(overrides))
+	for model, pricing := range defaultPricing {
+		table[model] = pricing
+	}
+	for model, pricing := range overrides {
+		table[model] = pricing
+	}
+	return table
+}
+
+// estimateCost fills in the estimated cost of usage for one image. Local
+// providers and unknown models cost nothing.
+func estimateCost(table map[string]ModelPricing, provider string, model string, quality string, usage *Usage) *Usage {
+	if usage == nil {
+		usage = &Usage{}
+	}
+
+	pricing, ok := table[model]
+	if !ok {
+		pricing, ok = table[provider+"/"+model]
+	}
+	if !ok {
+		usage.CostBasis = "unpriced"
+		return usage
+	}
+
+	if usage.TotalTokens > 0 && (pricing.InputPerMillion > 0 || pricing.OutputPerMillion > 0) {
+		output := usage.OutputTokens
+		if output == 0 {
+			output = usage.TotalTokens - usage.InputTokens
+		}
+		cost := float64(usage.InputTokens)*pricing.InputPerMillion/1e6 + float64(output)*pricing.OutputPerMillion/1e6
+		usage.EstimatedCostUSD = RoundCost(cost)
+		usage.CostBasis = "tokens"
+		return usage
+	}
+
+	if price, ok := pricing.PerImageByQuality[quality]; ok {
+		usage.EstimatedCostUSD = price
+		usage.CostBasis = "per_image"
+		return usage
+	}
+	usage.EstimatedCostUSD = pricing.PerImage
+	usage.CostBasis = "per_image"
+	return usage
+}
+
+// RoundCost rounds a USD amount to millionths of a dollar, the precision
+// manifests record costs in.
+func RoundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
@@ -0,0 +1,275 @@
+package warhol
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Style is a style profile loaded from styles/<name>.yaml.
+type Style struct {
+	Name         string   `yaml:"name"`
+	Description  string   `yaml:"description"`
+	PromptPrefix []string `yaml:"prompt_prefix"`
+	// PromptTemplate is an optional text/template that renders the
+	// positive prompt in place of the default composition.
+	PromptTemplate  string          `yaml:"prompt_template"`
+	NegativePrompt  []string        `yaml:"negative_prompt"`
+	SeedPolicy      SeedPolicy      `yaml:"seed_policy"`
+	StableDiffusion SDSettings      `yaml:"stable_diffusion"`
+	ComfyUI         ComfyUISettings `yaml:"comfyui"`
+	// References are golden images, relative to the style file, that
+	// generated images are scored against.
+	References     []string `yaml:"references"`
+	ScoreThreshold float64  `yaml:"score_threshold"`
+}
+
+// SeedPolicy chooses the seed sent to providers that accept one. Mode
+// "fixed" sends Seed; "random" lets the provider pick.
+type SeedPolicy struct {
+	Mode string `yaml:"mode"`
+	Seed *int64 `yaml:"seed"`
+}
+
+// SDSettings are sampler parameters used by the sd provider.
+type SDSettings struct {
+	Sampler           string  `yaml:"sampler"`
+	Scheduler         string  `yaml:"scheduler"`
+	Steps             int     `yaml:"steps"`
+	CFGScale          float64 `yaml:"cfg_scale"`
+	DenoisingStrength float64 `yaml:"denoising_strength"`
+}
+
+// Character is a character profile loaded from characters/<name>.yaml.
+type Character struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Traits      []string `yaml:"traits"`
+	Outfit      []string `yaml:"outfit"`
+	Prompt      string   `yaml:"prompt"`
+}
+
+// profileRoots are the directories profile names are resolved under, in
+// lookup order.
+type profileRoots []string
+
+// defaultProfileRoots finds profiles from the repository root as well as
+// from cli/.
+var defaultProfileRoots = profileRoots{".", ".."}
+
+func (r profileRoots) loadStyle(nameOrPath string) (Style, string, error) {
+	path, err := r.path("styles", nameOrPath)
+	if err != nil {
+		return Style{}, "", err
+	}
+
+	var profile Style
+	if err := loadYAML(path, &profile); err != nil {
+		return Style{}, "", err
+	}
+
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return profile, path, nil
+}
+
+func (r profileRoots) loadCharacter(nameOrPath string) (Character, string, error) {
+	path, err := r.path("characters", nameOrPath)
+	if err != nil {
+		return Character{}, "", err
+	}
+
+	var profile Character
+	if err := loadYAML(path, &profile); err != nil {
+		return Character{}, "", err
+	}
+
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return profile, path, nil
+}
+
+var errProfileNotFound = errors.New("profile not found")
+
+// path resolves a profile name or path. Relative paths are tried under
+// each root, and names as defaultDir/<name>.yaml (or .yml).
+func (r profileRoots) path(defaultDir string, nameOrPath string) (string, error) {
+	added := make(map[string]struct{}, 8)
+	candidates := make([]string, 0, 8)
+	add := func(path string) {
+		if _, exists := added[path]; exists {
+			return
+		}
+		added[path] = struct{}{}
+		candidates = append(candidates, path)
+	}
+
+	if filepath.IsAbs(nameOrPath) {
+		add(nameOrPath)
+	} else {
+		for _, root := range r {
+			add(filepath.Join(root, nameOrPath))
+		}
+	}
+
+	if filepath.Ext(nameOrPath) == "" {
+		for _, root := range r {
+			add(filepath.Join(root, defaultDir, nameOrPath+".yaml"))
+			add(filepath.Join(root, defaultDir, nameOrPath+".yml"))
+		}
+	} else if !strings.Contains(nameOrPath, string(os.PathSeparator)) {
+		for _, root := range r {
+			add(filepath.Join(root, defaultDir, nameOrPath))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", errProfileNotFound, nameOrPath)
+}
+
+// dirs returns the existing directories that profiles of the given kind
+// are resolved from, in lookup order.
+func (r profileRoots) dirs(defaultDir string) []string {
+	dirs := make([]string, 0, len(r))
+	for _, root := range r {
+		dir := filepath.Join(root, defaultDir)
+		if dirExists(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// list returns profile files of the given kind, skipping names shadowed
+// by an earlier directory.
+func (r profileRoots) list(defaultDir string) ([]string, error) {
+	seen := make(map[string]struct{})
+	paths := make([]string, 0, 8)
+	for _, dir := range r.dirs(defaultDir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if _, exists := seen[name]; exists {
+				continue
+			}
+			seen[name] = struct{}{}
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// seed returns the seed to request, or nil when the provider should pick
+// one at random.
+func (p SeedPolicy) seed() *int64 {
+	if p.Mode == "random" || p.Seed == nil {
+		return nil
+	}
+	seed := *p.Seed
+	return &seed
+}
+
+// ComfyUISettings points at a ComfyUI workflow (API format) relative to
+// the style profile.
+type ComfyUISettings struct {
+	Workflow string `yaml:"workflow"`
+}
+
+func validateStyleProfile(profile Style) error {
+	if strings.TrimSpace(profile.Description) == "" && len(filterNonEmpty(profile.PromptPrefix)) == 0 && strings.TrimSpace(profile.PromptTemplate) == "" {
+		return errors.New("style needs a description, a prompt_template or at least one prompt_prefix entry")
+	}
+	if _, err := parsePromptTemplate(profile); err != nil {
+		return fmt.Errorf("invalid prompt_template: %w", err)
+	}
+	if len(filterNonEmpty(profile.NegativePrompt)) != len(profile.NegativePrompt) {
+		return errors.New("negative_prompt contains empty entries")
+	}
+	switch profile.SeedPolicy.Mode {
+	case "", "fixed", "random":
+	default:
+		return fmt.Errorf("seed_policy.mode must be fixed or random, got %q", profile.SeedPolicy.Mode)
+	}
+	if profile.SeedPolicy.Mode == "fixed" && profile.SeedPolicy.Seed == nil {
+		return errors.New("seed_policy.mode fixed requires seed_policy.seed")
+	}
+	if sd := profile.StableDiffusion; sd.Steps < 0 || sd.CFGScale < 0 || sd.DenoisingStrength < 0 || sd.DenoisingStrength > 1 {
+		return errors.New("stable_diffusion settings must be non-negative and denoising_strength at most 1")
+	}
+	return validateScoreThreshold(profile)
+}
+
+// validateScoreThreshold checks score_threshold on its own, so generation
+// can reject a bad threshold without validating the whole profile.
+func validateScoreThreshold(profile Style) error {
+	if profile.ScoreThreshold < 0 || profile.ScoreThreshold > 1 {
+		return errors.New("score_threshold must be between 0 and 1")
+	}
+	if profile.ScoreThreshold > 0 && len(filterNonEmpty(profile.References)) == 0 {
+		return errors.New("score_threshold requires at least one entry in references")
+	}
+	return nil
+}
+
+func validateCharacterProfile(profile Character) error {
+	if strings.TrimSpace(profile.Description) == "" &&
+		strings.TrimSpace(profile.Prompt) == "" &&
+		len(filterNonEmpty(profile.Traits)) == 0 &&
+		len(filterNonEmpty(profile.Outfit)) == 0 {
+		return errors.New("character needs a description, traits, outfit or prompt")
+	}
+	return nil
+}
+
+func loadYAML(path string, out any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func filterNonEmpty(values []string) []string {
+	filtered := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed := strings.TrimSpace(value)
+		if trimmed != "" {
+			filtered = append(filtered, trimmed)
+		}
+	}
+	return filtered
+}
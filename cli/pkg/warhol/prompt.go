@@ -0,0 +1,201 @@
+package warhol
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Composition is the provider-neutral result of combining a style, an
+// optional character and the user prompt. Providers render it into their
+// own request format with renderPrompt.
+type Composition struct {
+	Positive    []string `json:"positive"`
+	Negative    []string `json:"negative,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+	AspectRatio string   `json:"aspect_ratio,omitempty"`
+	References  []string `json:"references,omitempty"`
+}
+
+// renderedPrompt is a Composition in the shape one provider expects.
+type renderedPrompt struct {
+	Prompt            string
+	NegativePrompt    string
+	SystemInstruction string
+}
+
+// promptData is what a style's prompt_template is executed with.
+// Character is nil when the generation has no character.
+type promptData struct {
+	Style     Style
+	Character *Character
+	Location  string
+	Prompt    string
+	Vars      map[string]string
+}
+
+// composePrompt combines the style, character, location and user prompt.
+// Styles with a prompt_template render the positive prompt with it;
+// otherwise the parts are joined in a fixed order.
+func composePrompt(style Style, character *Character, opts generateOptions) (Composition, error) {
+	negatives := make([]string, 0, len(style.NegativePrompt))
+	for _, negative := range filterNonEmpty(style.NegativePrompt) {
+		negatives = append(negatives, stripNegationPrefix(negative))
+	}
+	composed := Composition{
+		Negative:   filterNonEmpty(negatives),
+		Seed:       style.SeedPolicy.seed(),
+		References: opts.Refs,
+	}
+
+	if style.PromptTemplate != "" {
+		text, err := executePromptTemplate(style, promptData{
+			Style:     style,
+			Character: character,
+			Location:  opts.Location,
+			Prompt:    opts.Prompt,
+			Vars:      opts.Vars,
+		})
+		if err != nil {
+			return Composition{}, err
+		}
+		composed.Positive = filterNonEmpty([]string{text})
+		return composed, nil
+	}
+
+	parts := make([]string, 0, 12)
+
+	if style.Description != "" {
+		parts = append(parts, style.Description)
+	}
+	parts = append(parts, style.PromptPrefix...)
+
+	if character != nil {
+		if character.Prompt != "" {
+			parts = append(parts, character.Prompt)
+		} else {
+			if character.Description != "" {
+				parts = append(parts, character.Description)
+			}
+			if len(character.Traits) > 0 {
+				parts = append(parts, "Traits: "+strings.Join(character.Traits, ", "))
+			}
+			if len(character.Outfit) > 0 {
+				parts = append(parts, "Outfit: "+strings.Join(character.Outfit, ", "))
+			}
+		}
+	}
+
+	parts = append(parts, opts.Location, opts.Prompt)
+	composed.Positive = filterNonEmpty(parts)
+	return composed, nil
+}
+
+// parsePromptTemplate parses a style's prompt_template. Referencing a
+// variable that was not passed is an error; index .Vars "name" reads an
+// optional one.
+func parsePromptTemplate(style Style) (*template.Template, error) {
+	return template.New("prompt_template").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"join": func(items []string, sep string) string {
+			return strings.Join(filterNonEmpty(items), sep)
+		}}).
+		Parse(style.PromptTemplate)
+}
+
+// executePromptTemplate renders the template with data. Runs of
+// whitespace, including the line breaks of multi-line templates, collapse
+// to single spaces.
+func executePromptTemplate(style Style, data promptData) (string, error) {
+	tmpl, err := parsePromptTemplate(style)
+	if err != nil {
+		return "", WithCode(CodeProfile, fmt.Errorf("invalid prompt_template: %w", err))
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		return "", WithCode(CodeUsage, fmt.Errorf("failed to render prompt_template: %w", err))
+	}
+	return strings.Join(strings.Fields(text.String()), " "), nil
+}
+
+// renderPrompt turns a composed prompt into the text a provider reads:
+//   - sd, comfyui and queue providers with native_negative_prompt get
+//     comma-separated tags and a separate negative prompt;
+//   - google gets sentences, with negatives as a system instruction;
+//   - openai and other queue providers get sentences ending in an explicit
+//     exclusion, since "Avoid: x" tends to be read as "include x".
+func renderPrompt(roots profileRoots, provider string, prompt Composition) renderedPrompt {
+	if supportsNegativePrompt(roots, provider) {
+		return renderedPrompt{
+			Prompt:         strings.Join(trimSentenceEnds(prompt.Positive), ", "),
+			NegativePrompt: strings.Join(prompt.Negative, ", "),
+		}
+	}
+
+	text := joinSentences(prompt.Positive)
+	if len(prompt.Negative) == 0 {
+		return renderedPrompt{Prompt: text}
+	}
+
+	if provider == "google" {
+		return renderedPrompt{
+			Prompt:            text,
+			SystemInstruction: "Generate an image. The image must not contain any of the following: " + strings.Join(prompt.Negative, ", ") + ".",
+		}
+	}
+
+	return renderedPrompt{
+		Prompt: joinSentences([]string{text, "The image must not contain " + joinList(prompt.Negative)}),
+	}
+}
+
+// composedText renders a composition as plain sentences, for display.
+func composedText(prompt Composition) string {
+	text := joinSentences(prompt.Positive)
+	if len(prompt.Negative) == 0 {
+		return text
+	}
+	return joinSentences([]string{text, "Without " + joinList(prompt.Negative)})
+}
+
+func joinSentences(parts []string) string {
+	parts = trimSentenceEnds(parts)
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ". ") + "."
+}
+
+func trimSentenceEnds(parts []string) []string {
+	trimmed := make([]string, 0, len(parts))
+	for _, part := range filterNonEmpty(parts) {
+		if part = strings.TrimRight(part, ". "); part != "" {
+			trimmed = append(trimmed, part)
+		}
+	}
+	return trimmed
+}
+
+// joinList joins items as "a, b or c".
+func joinList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	default:
+		return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+	}
+}
+
+// stripNegationPrefix turns "avoid brand marks" into "brand marks" so the
+// item reads correctly in a negative field or exclusion sentence.
+func stripNegationPrefix(value string) string {
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"avoid ", "no ", "without ", "do not include "} {
+		if strings.HasPrefix(lower, prefix) {
+			return strings.TrimSpace(value[len(prefix):])
+		}
+	}
+	return value
+}
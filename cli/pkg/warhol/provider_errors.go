@@ -0,0 +1,116 @@
+package warhol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contentPolicyError reports a generation refused by the provider's safety
+// or moderation systems. Retrying the same prompt will not help.
+type contentPolicyError struct {
+	Provider string
+	Category string
+	Reason   string
+	Message  string
+}
+
+func (e *contentPolicyError) Error() string {
+	details := make([]string, 0, 2)
+	if e.Category != "" {
+		details = append(details, "category "+e.Category)
+	}
+	if e.Reason != "" {
+		details = append(details, "reason "+e.Reason)
+	}
+
+	msg := fmt.Sprintf("blocked by %s content policy", e.Provider)
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// statusError is a provider request that failed with an HTTP error status.
+// RetryAfter is the delay the provider asked for, if any.
+type statusError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s error: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s request failed with status %d", e.Provider, e.StatusCode)
+}
+
+// isRetryable reports whether repeating the request may succeed. Content
+// policy refusals are never retryable.
+func isRetryable(err error) bool {
+	var policy *contentPolicyError
+	if errors.As(err, &policy) {
+		return false
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+
+	// Timeouts and connection failures.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(header http.Header) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// Gemini finish and block reasons that mean the output was withheld for
+// policy reasons rather than failing for a transient one.
+var googlePolicyReasons = map[string]struct{}{
+	"SAFETY":                   {},
+	"RECITATION":               {},
+	"BLOCKLIST":                {},
+	"PROHIBITED_CONTENT":       {},
+	"SPII":                     {},
+	"IMAGE_SAFETY":             {},
+	"IMAGE_PROHIBITED_CONTENT": {},
+	"IMAGE_RECITATION":         {},
+}
+
+func isGooglePolicyReason(reason string) bool {
+	_, ok := googlePolicyReasons[reason]
+	return ok
+}
+
+// OpenAI error codes used for moderation rejections.
+func isOpenAIPolicyCode(code string) bool {
+	switch code {
+	case "moderation_blocked", "content_policy_violation", "content_filter":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package warhol
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var builtinProviders = []string{"google", "openai", "sd", "comfyui"}
+
+// imageRequest is everything a provider needs to render one image.
+type imageRequest struct {
+	Model          string
+	Prompt         string
+	NegativePrompt string
+	Instruction    string
+	Seed           *int64
+	Size           string
+	AspectRatio    string
+	Quality        string
+	References     []string
+	Style          Style
+	StyleFile      string
+}
+
+type imageResult struct {
+	Image []byte
+	Seed  *int64
+	Usage *Usage
+	Cache *CacheInfo
+}
+
+type imageProvider interface {
+	generateImage(ctx context.Context, req imageRequest) (imageResult, error)
+}
+
+func newImageProvider(roots profileRoots, provider string, logger *slog.Logger) (imageProvider, error) {
+	switch provider {
+	case "google":
+		return newGoogleClient(logger)
+	case "openai":
+		return newOpenAIClient(logger)
+	case "sd":
+		return newSDClient(logger)
+	case "comfyui":
+		return newComfyUIClient(logger)
+	default:
+		return newQueueClient(roots, provider, logger)
+	}
+}
+
+// DefaultBaseURL returns the endpoint a built-in provider uses when its
+// base URL variable, such as GEMINI_BASE_URL, is unset. It returns "" for
+// other providers.
+func DefaultBaseURL(provider string) string {
+	switch provider {
+	case "google":
+		return defaultGoogleBaseURL
+	case "openai":
+		return defaultOpenAIBaseURL
+	case "sd":
+		return defaultSDBaseURL
+	case "comfyui":
+		return defaultComfyUIBaseURL
+	default:
+		return ""
+	}
+}
+
+func unsupportedProviderError(provider string) error {
+	return fmt.Errorf("unsupported provider %q (expected one of %s, or a definition in providers/)", provider, strings.Join(builtinProviders, ", "))
+}
+
+func isBuiltinProvider(provider string) bool {
+	for _, name := range builtinProviders {
+		if name == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsNegativePrompt reports whether the provider takes negatives as a
+// separate field instead of an "Avoid: ..." sentence in the prompt.
+func supportsNegativePrompt(roots profileRoots, provider string) bool {
+	switch provider {
+	case "sd", "comfyui":
+		return true
+	case "google", "openai":
+		return false
+	}
+
+	def, _, err := roots.loadQueueProvider(provider)
+	return err == nil && def.NativeNegativePrompt
+}
+
+func parseSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(size)), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid size %q (expected WIDTHxHEIGHT)", size)
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (expected WIDTHxHEIGHT)", size)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (expected WIDTHxHEIGHT)", size)
+	}
+	return width, height, nil
+}
+
+func readReferenceImages(paths []string) ([][]byte, error) {
+	images := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read reference image: %w", err)
+		}
+		images = append(images, data)
+	}
+	return images, nil
+}
@@ -0,0 +1,496 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultQueuePollInterval = 2 * time.Second
+	defaultQueueTimeout      = 10 * time.Minute
+)
+
+// queueProviderDefinition describes a submit -> poll -> fetch image API.
+// Definitions live in providers/<name>.yaml.
+type queueProviderDefinition struct {
+	Name                 string            `yaml:"name"`
+	BaseURL              string            `yaml:"base_url"`
+	BaseURLEnv           string            `yaml:"base_url_env"`
+	DefaultModel         string            `yaml:"default_model"`
+	NativeNegativePrompt bool              `yaml:"native_negative_prompt"`
+	Auth                 queueAuth         `yaml:"auth"`
+	Submit               queueSubmit       `yaml:"submit"`
+	Status               queueStatus       `yaml:"status"`
+	Result               queueResult       `yaml:"result"`
+	Headers              map[string]string `yaml:"headers"`
+}
+
+type queueAuth struct {
+	Header string `yaml:"header"`
+	Prefix string `yaml:"prefix"`
+	Env    string `yaml:"env"`
+}
+
+type queueSubmit struct {
+	Method string `yaml:"method"`
+	URL    string `yaml:"url"`
+	Body   string `yaml:"body"`
+	IDPath string `yaml:"id_path"`
+}
+
+type queueStatus struct {
+	Method    string   `yaml:"method"`
+	URL       string   `yaml:"url"`
+	Path      string   `yaml:"path"`
+	Success   []string `yaml:"success"`
+	Failure   []string `yaml:"failure"`
+	ErrorPath string   `yaml:"error_path"`
+	Interval  string   `yaml:"interval"`
+	Timeout   string   `yaml:"timeout"`
+
+	// interval and timeout are Interval and Timeout parsed by
+	// validateQueueProviderDefinition, with defaults applied.
+	interval time.Duration
+	timeout  time.Duration
+}
+
+type queueResult struct {
+	URL      string `yaml:"url"`
+	Path     string `yaml:"path"`
+	Encoding string `yaml:"encoding"`
+}
+
+// queueTemplateData is available to every URL and body template.
+type queueTemplateData struct {
+	BaseURL        string
+	Model          string
+	Prompt         string
+	NegativePrompt string
+	Seed           *int64
+	Size           string
+	Width          int
+	Height         int
+	Quality        string
+	References     []string
+	ID             string
+}
+
+type queueClient struct {
+	def    queueProviderDefinition
+	client *http.Client
+	logger *slog.Logger
+}
+
+func (r profileRoots) loadQueueProvider(name string) (queueProviderDefinition, string, error) {
+	path, err := r.path("providers", name)
+	if err != nil {
+		return queueProviderDefinition{}, "", err
+	}
+
+	var def queueProviderDefinition
+	if err := loadYAML(path, &def); err != nil {
+		return queueProviderDefinition{}, "", err
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := validateQueueProviderDefinition(&def); err != nil {
+		return queueProviderDefinition{}, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return def, path, nil
+}
+
+// validateQueueProviderDefinition checks def and parses its status
+// interval and timeout.
+func validateQueueProviderDefinition(def *queueProviderDefinition) error {
+	if def.Submit.URL == "" || def.Submit.IDPath == "" {
+		return errors.New("submit.url and submit.id_path are required")
+	}
+	if def.Status.URL == "" || def.Status.Path == "" || len(def.Status.Success) == 0 {
+		return errors.New("status.url, status.path and status.success are required")
+	}
+	if def.Result.Path == "" {
+		return errors.New("result.path is required")
+	}
+	switch def.Result.Encoding {
+	case "", "url", "base64":
+	default:
+		return fmt.Errorf("result.encoding must be url or base64, got %q", def.Result.Encoding)
+	}
+	var err error
+	if def.Status.interval, err = parseQueueDuration("status.interval", def.Status.Interval, defaultQueuePollInterval); err != nil {
+		return err
+	}
+	if def.Status.timeout, err = parseQueueDuration("status.timeout", def.Status.Timeout, defaultQueueTimeout); err != nil {
+		return err
+	}
+	for name, value := range def.Headers {
+		if err := checkHeaderVariables(name, value, def.Auth.Env); err != nil {
+			return err
+		}
+	}
+	for _, tmpl := range []string{def.Submit.URL, def.Submit.Body, def.Status.URL, def.Result.URL} {
+		if _, err := parseQueueTemplate(tmpl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseQueueDuration parses a positive duration, or returns fallback for
+// an empty value.
+func parseQueueDuration(name string, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid duration %q", name, value)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %q", name, value)
+	}
+	return duration, nil
+}
+
+// checkHeaderVariables rejects a header that references any environment
+// variable other than the provider's auth.env, so a definition cannot
+// send other secrets to its API.
+func checkHeaderVariables(name string, value string, authEnv string) error {
+	var err error
+	os.Expand(value, func(variable string) string {
+		if variable != authEnv && err == nil {
+			err = fmt.Errorf("headers.%s may only reference auth.env, not $%s", name, variable)
+		}
+		return ""
+	})
+	return err
+}
+
+func newQueueClient(roots profileRoots, name string, logger *slog.Logger) (*queueClient, error) {
+	def, _, err := roots.loadQueueProvider(name)
+	if err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			return nil, unsupportedProviderError(name)
+		}
+		return nil, err
+	}
+
+	if def.BaseURLEnv != "" {
+		if value := strings.TrimSpace(os.Getenv(def.BaseURLEnv)); value != "" {
+			def.BaseURL = value
+		}
+	}
+	def.BaseURL = strings.TrimRight(def.BaseURL, "/")
+
+	return &queueClient{
+		def:    def,
+		client: &http.Client{Timeout: 120 * time.Second},
+		logger: logger,
+	}, nil
+}
+
+func parseQueueTemplate(text string) (*template.Template, error) {
+	return template.New("queue").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}).Parse(text)
+}
+
+func renderQueueTemplate(text string, data queueTemplateData) (string, error) {
+	tmpl, err := parseQueueTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c *queueClient) generateImage(ctx context.Context, req imageRequest) (imageResult, error) {
+	data := queueTemplateData{
+		BaseURL:        c.def.BaseURL,
+		Model:          req.Model,
+		Prompt:         req.Prompt,
+		NegativePrompt: req.NegativePrompt,
+		Seed:           req.Seed,
+		Size:           req.Size,
+		Quality:        req.Quality,
+	}
+	if req.Size != "" {
+		width, height, err := parseSize(req.Size)
+		if err != nil {
+			return imageResult{}, err
+		}
+		data.Width, data.Height = width, height
+	}
+	images, err := readReferenceImages(req.References)
+	if err != nil {
+		return imageResult{}, err
+	}
+	for _, image := range images {
+		data.References = append(data.References, base64.StdEncoding.EncodeToString(image))
+	}
+
+	submitted, err := c.call(ctx, c.def.Submit.Method, c.def.Submit.URL, c.def.Submit.Body, data)
+	if err != nil {
+		return imageResult{}, fmt.Errorf("submit: %w", err)
+	}
+	id, ok := lookupJSONPath(submitted, c.def.Submit.IDPath)
+	if !ok {
+		return imageResult{}, fmt.Errorf("submit response has no %q", c.def.Submit.IDPath)
+	}
+	data.ID = fmt.Sprint(id)
+	c.logger.Debug("queue job submitted", "provider", c.def.Name, "id", data.ID)
+
+	status, err := c.waitForJob(ctx, data)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	result := status
+	if c.def.Result.URL != "" {
+		result, err = c.call(ctx, http.MethodGet, c.def.Result.URL, "", data)
+		if err != nil {
+			return imageResult{}, fmt.Errorf("fetch result: %w", err)
+		}
+	}
+
+	value, ok := lookupJSONPath(result, c.def.Result.Path)
+	text, isString := value.(string)
+	if !ok || !isString || text == "" {
+		return imageResult{}, fmt.Errorf("%s response did not include image data at %q", c.def.Name, c.def.Result.Path)
+	}
+
+	encoding := c.def.Result.Encoding
+	if encoding == "" {
+		encoding = "base64"
+		if strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") {
+			encoding = "url"
+		}
+	}
+	if encoding == "url" {
+		imageBytes, err := c.download(ctx, text)
+		if err != nil {
+			return imageResult{}, err
+		}
+		return imageResult{Image: imageBytes}, nil
+	}
+
+	if _, payload, found := strings.Cut(text, ";base64,"); found {
+		text = payload
+	}
+	imageBytes, err := decodeBase64Image(text)
+	if err != nil {
+		return imageResult{}, err
+	}
+	return imageResult{Image: imageBytes}, nil
+}
+
+func (c *queueClient) waitForJob(ctx context.Context, data queueTemplateData) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.def.Status.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.def.Status.interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.call(ctx, c.def.Status.Method, c.def.Status.URL, "", data)
+		if err != nil {
+			return nil, fmt.Errorf("poll: %w", err)
+		}
+
+		value, _ := lookupJSONPath(status, c.def.Status.Path)
+		state := fmt.Sprint(value)
+		c.logger.Debug("queue job status", "provider", c.def.Name, "id", data.ID, "status", state)
+		if containsFold(c.def.Status.Success, state) {
+			return status, nil
+		}
+		if containsFold(c.def.Status.Failure, state) {
+			message := state
+			if c.def.Status.ErrorPath != "" {
+				if detail, ok := lookupJSONPath(status, c.def.Status.ErrorPath); ok {
+					message = fmt.Sprint(detail)
+				}
+			}
+			return nil, fmt.Errorf("%s job %s failed: %s", c.def.Name, data.ID, message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for %s job %s: %w", c.def.Name, data.ID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// call renders the URL and body templates, sends the request and decodes
+// the JSON response.
+func (c *queueClient) call(ctx context.Context, method string, urlTemplate string, bodyTemplate string, data queueTemplateData) (any, error) {
+	endpoint, err := renderQueueTemplate(urlTemplate, data)
+	if err != nil {
+		return nil, fmt.Errorf("render url: %w", err)
+	}
+
+	var reqBody []byte
+	if bodyTemplate != "" {
+		rendered, err := renderQueueTemplate(bodyTemplate, data)
+		if err != nil {
+			return nil, fmt.Errorf("render body: %w", err)
+		}
+		reqBody = []byte(rendered)
+	}
+
+	if method == "" {
+		method = http.MethodGet
+		if reqBody != nil {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), strings.TrimSpace(endpoint), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, c.def.Name, req, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload any
+	decodeErr := json.Unmarshal(respBody, &payload)
+	if resp.StatusCode >= 400 {
+		statusErr := &statusError{Provider: c.def.Name, StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header)}
+		if c.def.Status.ErrorPath != "" {
+			if detail, ok := lookupJSONPath(payload, c.def.Status.ErrorPath); ok {
+				statusErr.Message = fmt.Sprint(detail)
+			}
+		}
+		return nil, statusErr
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decode response: %w", decodeErr)
+	}
+	return payload, nil
+}
+
+// authorize sets the configured headers and the auth header. The
+// auth.env variable is the only one read from the environment.
+func (c *queueClient) authorize(req *http.Request) {
+	token := ""
+	if c.def.Auth.Env != "" {
+		token = strings.TrimSpace(os.Getenv(c.def.Auth.Env))
+	}
+	for name, value := range c.def.Headers {
+		req.Header.Set(name, os.Expand(value, func(string) string { return token }))
+	}
+	if c.def.Auth.Env == "" {
+		return
+	}
+
+	header := c.def.Auth.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	if token != "" {
+		req.Header.Set(header, c.def.Auth.Prefix+token)
+	}
+}
+
+// download fetches an image URL from a job result. Credentials are only
+// sent when the URL is on the provider's own base URL.
+func (c *queueClient) download(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.onBaseURL(req.URL) {
+		c.authorize(req)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.logger.Debug("provider image download", "provider", c.def.Name, "status", resp.StatusCode, "latency", time.Since(start))
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// onBaseURL reports whether target has the scheme and host of the base
+// URL. It is false when the provider has no base URL.
+func (c *queueClient) onBaseURL(target *url.URL) bool {
+	if c.def.BaseURL == "" {
+		return false
+	}
+	base, err := url.Parse(c.def.BaseURL)
+	if err != nil || base.Host == "" {
+		return false
+	}
+	return strings.EqualFold(base.Scheme, target.Scheme) && strings.EqualFold(base.Host, target.Host)
+}
+
+// lookupJSONPath walks a decoded JSON value along a dot-separated path.
+// Numeric segments index into arrays, e.g. "output.images.0.url".
+func lookupJSONPath(value any, path string) (any, bool) {
+	if path == "" || path == "." {
+		return value, true
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		switch typed := value.(type) {
+		case map[string]any:
+			next, ok := typed[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, false
+			}
+			value = typed[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
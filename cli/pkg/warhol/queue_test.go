@@ -0,0 +1,229 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testQueueProvider = `
+base_url_env: TEST_QUEUE_URL
+auth:
+  prefix: "Bearer "
+  env: TEST_QUEUE_TOKEN
+headers:
+  X-Api-Key: "${TEST_QUEUE_TOKEN}"
+submit:
+  url: "{{.BaseURL}}/jobs"
+  body: '{"prompt": {{json .Prompt}}, "width": {{.Width}}, "height": {{.Height}}}'
+  id_path: "job.id"
+status:
+  url: "{{.BaseURL}}/jobs/{{.ID}}"
+  path: "status"
+  success: ["done"]
+  failure: ["failed"]
+  error_path: "error"
+  interval: 10ms
+  timeout: 5s
+result:
+  path: "images.0"
+`
+
+// writeQueueProvider writes providers/<name>.yaml under a new project
+// directory and returns the directory.
+func writeQueueProvider(t *testing.T, name string, definition string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "providers")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(definition), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestQueueProviderGenerateImage(t *testing.T) {
+	image := []byte("\x89PNG fake image")
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+		}
+		if got := r.Header.Get("X-Api-Key"); got != "secret" {
+			t.Errorf("X-Api-Key = %q, want %q", got, "secret")
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/jobs":
+			var body map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("decode submit body: %v", err)
+			}
+			if body["prompt"] != `a "quoted" cat` || body["width"] != 512.0 || body["height"] != 256.0 {
+				t.Errorf("submit body = %v", body)
+			}
+			io.WriteString(w, `{"job": {"id": "42"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/jobs/42":
+			polls++
+			if polls < 2 {
+				io.WriteString(w, `{"status": "running"}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"status": "done", "images": []string{base64.StdEncoding.EncodeToString(image)}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_QUEUE_URL", server.URL)
+	t.Setenv("TEST_QUEUE_TOKEN", "secret")
+	root := writeQueueProvider(t, "test-queue", testQueueProvider)
+
+	client, err := newQueueClient(profileRoots{root}, "test-queue", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.generateImage(context.Background(), imageRequest{Prompt: `a "quoted" cat`, Size: "512x256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Image, image) {
+		t.Errorf("image = %q, want %q", result.Image, image)
+	}
+	if polls != 2 {
+		t.Errorf("polled %d times, want 2", polls)
+	}
+}
+
+func TestQueueProviderJobFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			io.WriteString(w, `{"job": {"id": "7"}}`)
+			return
+		}
+		io.WriteString(w, `{"status": "failed", "error": "out of memory"}`)
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_QUEUE_URL", server.URL)
+	root := writeQueueProvider(t, "test-queue", testQueueProvider)
+
+	client, err := newQueueClient(profileRoots{root}, "test-queue", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.generateImage(context.Background(), imageRequest{Prompt: "cat"})
+	if err == nil || !strings.Contains(err.Error(), "out of memory") {
+		t.Fatalf("error = %v, want the job's error message", err)
+	}
+}
+
+func TestQueueProviderRejectsOtherEnvironmentVariables(t *testing.T) {
+	tests := map[string]string{
+		"header":   strings.Replace(testQueueProvider, "${TEST_QUEUE_TOKEN}", "${HOME}", 1),
+		"template": strings.Replace(testQueueProvider, `{{json .Prompt}}`, `{{env "HOME"}}`, 1),
+	}
+	for name, definition := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := writeQueueProvider(t, "test-queue", definition)
+			if _, _, err := (profileRoots{root}).loadQueueProvider("test-queue"); err == nil {
+				t.Fatal("loadQueueProvider succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestQueueProviderRejectsNonPositiveDurations(t *testing.T) {
+	tests := map[string][2]string{
+		"zero interval":     {"interval: 10ms", "interval: 0s"},
+		"negative interval": {"interval: 10ms", "interval: -1s"},
+		"zero timeout":      {"timeout: 5s", "timeout: 0s"},
+		"negative timeout":  {"timeout: 5s", "timeout: -5m"},
+	}
+	for name, replace := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := writeQueueProvider(t, "test-queue", strings.Replace(testQueueProvider, replace[0], replace[1], 1))
+			if _, _, err := (profileRoots{root}).loadQueueProvider("test-queue"); err == nil || !strings.Contains(err.Error(), "must be positive") {
+				t.Fatalf("error = %v, want a non-positive duration error", err)
+			}
+		})
+	}
+}
+
+func TestQueueProviderDownloadKeepsCredentialsOnBaseURL(t *testing.T) {
+	image := []byte("\x89PNG fake image")
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range []string{"Authorization", "X-Api-Key"} {
+			if got := r.Header.Get(header); got != "" {
+				t.Errorf("%s = %q sent to another host", header, got)
+			}
+		}
+		w.Write(image)
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			io.WriteString(w, `{"job": {"id": "1"}}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "done", "images": []string{other.URL + "/image.png"}})
+	}))
+	defer server.Close()
+
+	// Without a base URL, no download URL counts as the provider's own.
+	t.Setenv("TEST_QUEUE_TOKEN", "secret")
+	definition := strings.Replace(testQueueProvider, "base_url_env: TEST_QUEUE_URL\n", "", 1)
+	root := writeQueueProvider(t, "test-queue", strings.ReplaceAll(definition, "{{.BaseURL}}", server.URL))
+
+	client, err := newQueueClient(profileRoots{root}, "test-queue", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.generateImage(context.Background(), imageRequest{Prompt: "cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Image, image) {
+		t.Errorf("image = %q, want %q", result.Image, image)
+	}
+}
+
+func TestQueueClientOnBaseURL(t *testing.T) {
+	tests := []struct {
+		base   string
+		target string
+		want   bool
+	}{
+		{"https://api.example.com/v1", "https://api.example.com/files/1.png", true},
+		{"https://api.example.com/v1", "https://API.example.com/files/1.png", true},
+		{"https://api.example.com", "https://api.example.com.evil/1.png", false},
+		{"https://api.example.com", "http://api.example.com/1.png", false},
+		{"https://api.example.com", "https://api.example.com:8443/1.png", false},
+		{"", "https://anything.example/1.png", false},
+	}
+	for _, test := range tests {
+		client := &queueClient{def: queueProviderDefinition{BaseURL: test.base}}
+		target, err := url.Parse(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.onBaseURL(target); got != test.want {
+			t.Errorf("onBaseURL(%q) with base %q = %v, want %v", test.target, test.base, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package warhol
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig is a client-side request limit for a provider or a
+// provider/model pair.
+type RateLimitConfig struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	Burst             int     `yaml:"burst"`
+}
+
+// rateLimiters hands out one limiter per configured provider or
+// provider/model key, shared by every worker in the process.
+type rateLimiters struct {
+	mu       sync.Mutex
+	configs  map[string]RateLimitConfig
+	limiters map[string]*rateLimiter
+}
+
+func newRateLimiters(configs map[string]RateLimitConfig) *rateLimiters {
+	normalized := make(map[string]RateLimitConfig, len(configs))
+	for key, cfg := range configs {
+		if cfg.RequestsPerMinute > 0 {
+			normalized[strings.ToLower(key)] = cfg
+		}
+	}
+	return &rateLimiters{configs: normalized, limiters: map[string]*rateLimiter{}}
+}
+
+// forTarget returns the limiter for provider and model, preferring a
+// "provider/model" entry over a plain "provider" one. It returns nil when
+// neither is configured.
+func (r *rateLimiters) forTarget(provider string, model string) *rateLimiter {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := r.keyFor(provider, model)
+	if key == "" {
+		return nil
+	}
+	limiter, ok := r.limiters[key]
+	if !ok {
+		limiter = newRateLimiter(key, r.configs[key])
+		r.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// keyFor returns the configured key that limits provider and model, or "".
+func (r *rateLimiters) keyFor(provider string, model string) string {
+	if r == nil {
+		return ""
+	}
+	for _, key := range []string{strings.ToLower(provider + "/" + model), strings.ToLower(provider)} {
+		if _, ok := r.configs[key]; ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// rateLimiter is a token bucket. 429 responses halve the refill rate and
+// pause the bucket for the provider's Retry-After; successful calls restore
+// the configured rate gradually.
+type rateLimiter struct {
+	mu          sync.Mutex
+	key         string
+	limit       float64
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(key string, cfg RateLimitConfig) *rateLimiter {
+	burst := float64(max(cfg.Burst, 1))
+	limit := cfg.RequestsPerMinute / 60
+	return &rateLimiter{key: key, limit: limit, rate: limit, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until a request may be sent and returns how long it waited.
+func (l *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	var waited time.Duration
+	for {
+		delay := l.take()
+		if delay == 0 {
+			return waited, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return waited, ctx.Err()
+		case <-timer.C:
+			waited += delay
+		}
+	}
+}
+
+// take consumes a token, or returns how long to wait before trying again.
+func (l *rateLimiter) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		l.last = l.pausedUntil
+		return l.pausedUntil.Sub(now)
+	}
+
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// observe adjusts the rate after a request completed with err.
+func (l *rateLimiter) observe(err error) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var status *statusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusTooManyRequests {
+		if err == nil {
+			l.rate = min(l.limit, l.rate+l.limit/10)
+		}
+		return
+	}
+
+	pause := status.RetryAfter
+	if pause <= 0 {
+		pause = time.Duration(float64(time.Second) / l.rate)
+	}
+	if until := time.Now().Add(pause); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.rate = max(l.rate/2, l.limit/16)
+	l.tokens = 0
+}
@@ -0,0 +1,152 @@
+package warhol
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"path/filepath"
+
+	"github.com/mattbratos/warhol/cli/internal/imaging"
+)
+
+// Feature weights in the overall style score.
+const (
+	histogramWeight = 0.35
+	paletteWeight   = 0.30
+	edgeWeight      = 0.15
+	hashWeight      = 0.20
+)
+
+// Score compares an image with a style's golden references. Every
+// component is a similarity in 0..1 averaged over the references.
+type Score struct {
+	Score          float64  `json:"score"`
+	Histogram      float64  `json:"histogram"`
+	Palette        float64  `json:"palette"`
+	EdgeDensity    float64  `json:"edge_density"`
+	PerceptualHash float64  `json:"perceptual_hash"`
+	References     int      `json:"references"`
+	Threshold      float64  `json:"threshold,omitempty"`
+	Passed         *bool    `json:"passed,omitempty"`
+	Colors         []string `json:"colors,omitempty"`
+}
+
+// Scorer holds the precomputed features of a style's references.
+type Scorer struct {
+	references []imaging.Features
+	threshold  float64
+}
+
+// ReferencePaths resolves the style's golden reference images
+// relative to the style file.
+func (style Style) ReferencePaths(styleFile string) []string {
+	paths := make([]string, 0, len(style.References))
+	for _, ref := range filterNonEmpty(style.References) {
+		if !filepath.IsAbs(ref) {
+			ref = filepath.Join(filepath.Dir(styleFile), ref)
+		}
+		paths = append(paths, ref)
+	}
+	return paths
+}
+
+// NewScorer loads the reference images of style. Images scoring below
+// threshold do not pass; a zero threshold disables the check.
+func NewScorer(style Style, styleFile string, threshold float64) (*Scorer, error) {
+	paths := style.ReferencePaths(styleFile)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("style %s declares no references to score against", style.Name)
+	}
+
+	scorer := &Scorer{threshold: threshold}
+	for _, path := range paths {
+		img, err := imaging.DecodeFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("style reference: %w", err)
+		}
+		scorer.references = append(scorer.references, imaging.ExtractFeatures(img))
+	}
+	return scorer, nil
+}
+
+func (s *Scorer) scoreBytes(data []byte) (Score, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Score{}, fmt.Errorf("decode image: %w", err)
+	}
+	return s.Score(img), nil
+}
+
+// Score compares img with every reference and averages the signals.
+func (s *Scorer) Score(img image.Image) Score {
+	features := imaging.ExtractFeatures(img)
+	result := Score{References: len(s.references), Threshold: s.threshold}
+	for _, ref := range s.references {
+		result.Histogram += histogramSimilarity(features.Histogram, ref.Histogram)
+		result.Palette += (paletteSimilarity(features.Palette, ref.Palette) + paletteSimilarity(ref.Palette, features.Palette)) / 2
+		result.EdgeDensity += ratioSimilarity(features.EdgeDensity, ref.EdgeDensity)
+		result.PerceptualHash += 1 - float64(bits.OnesCount64(features.Hash^ref.Hash))/64
+	}
+
+	n := float64(len(s.references))
+	result.Histogram = imaging.Round(result.Histogram / n)
+	result.Palette = imaging.Round(result.Palette / n)
+	result.EdgeDensity = imaging.Round(result.EdgeDensity / n)
+	result.PerceptualHash = imaging.Round(result.PerceptualHash / n)
+	result.Score = imaging.Round(histogramWeight*result.Histogram + paletteWeight*result.Palette +
+		edgeWeight*result.EdgeDensity + hashWeight*result.PerceptualHash)
+	for _, color := range features.Palette {
+		result.Colors = append(result.Colors, color.Hex())
+	}
+
+	if s.threshold > 0 {
+		passed := result.Score >= s.threshold
+		result.Passed = &passed
+	}
+	return result
+}
+
+// histogramSimilarity is the intersection of two normalized histograms.
+func histogramSimilarity(a []float64, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Min(a[i], b[i])
+	}
+	return sum
+}
+
+// paletteSimilarity weighs, for each color of a, how close the nearest
+// color of b is.
+func paletteSimilarity(a []imaging.Color, b []imaging.Color) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	maxDistance := math.Sqrt(3 * 255 * 255)
+	var sum, weights float64
+	for _, ca := range a {
+		nearest := maxDistance
+		for _, cb := range b {
+			nearest = math.Min(nearest, colorDistance(ca, cb))
+		}
+		sum += ca.Weight * (1 - nearest/maxDistance)
+		weights += ca.Weight
+	}
+	return sum / weights
+}
+
+func colorDistance(a imaging.Color, b imaging.Color) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+func ratioSimilarity(a float64, b float64) float64 {
+	if a == b {
+		return 1
+	}
+	return 1 - math.Abs(a-b)/math.Max(a, b)
+}
@@ -0,0 +1,171 @@
+package warhol
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSDBaseURL = "http://127.0.0.1:7860"
+	defaultSDModel   = "default"
+)
+
+// sdClient talks to an Automatic1111/Forge-compatible /sdapi/v1 API.
+type sdClient struct {
+	baseURL string
+	auth    string
+	client  *http.Client
+	logger  *slog.Logger
+}
+
+type sdRequest struct {
+	Prompt            string         `json:"prompt"`
+	NegativePrompt    string         `json:"negative_prompt,omitempty"`
+	Seed              int64          `json:"seed"`
+	Width             int            `json:"width"`
+	Height            int            `json:"height"`
+	SamplerName       string         `json:"sampler_name,omitempty"`
+	Scheduler         string         `json:"scheduler,omitempty"`
+	Steps             int            `json:"steps,omitempty"`
+	CFGScale          float64        `json:"cfg_scale,omitempty"`
+	InitImages        []string       `json:"init_images,omitempty"`
+	DenoisingStrength float64        `json:"denoising_strength,omitempty"`
+	OverrideSettings  map[string]any `json:"override_settings,omitempty"`
+}
+
+type sdResponse struct {
+	Images []string `json:"images"`
+	Info   string   `json:"info"`
+	Error  string   `json:"error,omitempty"`
+	Detail any      `json:"detail,omitempty"`
+}
+
+func newSDClient(logger *slog.Logger) (*sdClient, error) {
+	baseURL := strings.TrimSpace(os.Getenv("SD_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultSDBaseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return &sdClient{
+		baseURL: baseURL,
+		auth:    strings.TrimSpace(os.Getenv("SD_API_AUTH")),
+		client:  &http.Client{Timeout: 600 * time.Second},
+		logger:  logger,
+	}, nil
+}
+
+func (c *sdClient) generateImage(ctx context.Context, req imageRequest) (imageResult, error) {
+	width, height, err := parseSize(req.Size)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	settings := req.Style.StableDiffusion
+	payload := sdRequest{
+		Prompt:         req.Prompt,
+		NegativePrompt: req.NegativePrompt,
+		Seed:           -1,
+		Width:          width,
+		Height:         height,
+		SamplerName:    settings.Sampler,
+		Scheduler:      settings.Scheduler,
+		Steps:          settings.Steps,
+		CFGScale:       settings.CFGScale,
+	}
+	if req.Seed != nil {
+		payload.Seed = *req.Seed
+	}
+	if req.Model != "" && req.Model != defaultSDModel {
+		payload.OverrideSettings = map[string]any{"sd_model_checkpoint": req.Model}
+	}
+
+	endpoint := "/sdapi/v1/txt2img"
+	if len(req.References) > 0 {
+		images, err := readReferenceImages(req.References)
+		if err != nil {
+			return imageResult{}, err
+		}
+		for _, image := range images {
+			payload.InitImages = append(payload.InitImages, base64.StdEncoding.EncodeToString(image))
+		}
+		payload.DenoisingStrength = settings.DenoisingStrength
+		if payload.DenoisingStrength == 0 {
+			payload.DenoisingStrength = 0.75
+		}
+		endpoint = "/sdapi/v1/img2img"
+	}
+
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return imageResult{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if user, pass, ok := strings.Cut(c.auth, ":"); ok {
+		httpReq.SetBasicAuth(user, pass)
+	}
+
+	resp, respBody, err := doTracedRequest(c.client, c.logger, "sd", httpReq, reqBody)
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	var result sdResponse
+	decodeErr := json.Unmarshal(respBody, &result)
+
+	if resp.StatusCode >= 400 {
+		return imageResult{}, &statusError{Provider: "sd", StatusCode: resp.StatusCode, Message: sdErrorMessage(result)}
+	}
+
+	if decodeErr != nil {
+		return imageResult{}, fmt.Errorf("decode response: %w", decodeErr)
+	}
+
+	if len(result.Images) == 0 {
+		return imageResult{}, fmt.Errorf("sd response did not include image data")
+	}
+
+	imageBytes, err := decodeBase64Image(result.Images[0])
+	if err != nil {
+		return imageResult{}, err
+	}
+
+	return imageResult{Image: imageBytes, Seed: sdSeedFromInfo(result.Info)}, nil
+}
+
+// sdSeedFromInfo extracts the seed actually used, which differs from the
+// requested one when the request asked for a random seed (-1).
+func sdSeedFromInfo(info string) *int64 {
+	var parsed struct {
+		Seed *int64 `json:"seed"`
+	}
+	if info == "" || json.Unmarshal([]byte(info), &parsed) != nil {
+		return nil
+	}
+	return parsed.Seed
+}
+
+func sdErrorMessage(result sdResponse) string {
+	if detail, ok := result.Detail.(string); ok && detail != "" {
+		return detail
+	}
+	if result.Detail != nil {
+		if data, err := json.Marshal(result.Detail); err == nil {
+			return string(data)
+		}
+	}
+	return result.Error
+}
@@ -0,0 +1,201 @@
+package warhol
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxWildcardCombinations caps ExpandOptions.All so a prompt with many
+// wildcards cannot queue an unbounded number of generations.
+const maxWildcardCombinations = 1000
+
+// wildcardPattern matches inline alternatives such as {left|right} and
+// file wildcards such as __weather__. Braces without a | are left alone.
+var wildcardPattern = regexp.MustCompile(`\{([^{}]*\|[^{}]*)\}|__([A-Za-z0-9][A-Za-z0-9_-]*?)__`)
+
+// Wildcards records how a prompt with wildcards was expanded. Expand sets
+// it on each request, and it is copied to the manifest.
+type Wildcards struct {
+	// Template is the prompt before expansion.
+	Template string `json:"template"`
+	// Mode is "all" or "sample".
+	Mode string `json:"mode"`
+	// Seed is the seed samples were drawn with.
+	Seed   *int64          `json:"seed,omitempty"`
+	Values []WildcardValue `json:"values"`
+}
+
+// WildcardValue is the value chosen for one wildcard of the template, in
+// the order the wildcards appear.
+type WildcardValue struct {
+	Token string `json:"token"`
+	Value string `json:"value"`
+}
+
+// ExpandOptions control Expand.
+type ExpandOptions struct {
+	// All expands every combination, in order. Otherwise Sample
+	// expansions are drawn at random.
+	All bool
+	// Sample is the number of random expansions. It defaults to 1.
+	Sample int
+	// Seed makes samples reproducible. When nil a random seed is used;
+	// either way it is recorded in Wildcards.Seed.
+	Seed *int64
+}
+
+// wildcardSlot is one wildcard of a prompt with the text before it.
+type wildcardSlot struct {
+	prefix  string
+	token   string
+	options []string
+}
+
+// Expand replaces the wildcards in req.Prompt and returns one request per
+// expansion. {a|b|c} picks one of its alternatives and __name__ picks a
+// line of wildcards/name.txt in the project. A prompt without
+// wildcards is returned unchanged.
+func (c *Client) Expand(req Request, opts ExpandOptions) ([]Request, error) {
+	slots, tail, err := parseWildcards(c.roots, req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return []Request{req}, nil
+	}
+
+	if opts.All {
+		total := 1
+		for _, slot := range slots {
+			total *= len(slot.options)
+			if total > maxWildcardCombinations {
+				return nil, WithCode(CodeUsage, fmt.Errorf("prompt expands to more than %d combinations; sample it instead", maxWildcardCombinations))
+			}
+		}
+
+		requests := make([]Request, 0, total)
+		choice := make([]int, len(slots))
+		for range total {
+			requests = append(requests, expandRequest(req, slots, tail, choice, "all", nil))
+			// Advance the last wildcard fastest, like nested loops.
+			for i := len(choice) - 1; i >= 0; i-- {
+				if choice[i]++; choice[i] < len(slots[i].options) {
+					break
+				}
+				choice[i] = 0
+			}
+		}
+		return requests, nil
+	}
+
+	sample := opts.Sample
+	if sample == 0 {
+		sample = 1
+	}
+	if sample < 0 {
+		return nil, WithCode(CodeUsage, errors.New("sample must be at least 1"))
+	}
+	seed := rand.Int64N(1 << 31)
+	if opts.Seed != nil {
+		seed = *opts.Seed
+	}
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+
+	requests := make([]Request, 0, sample)
+	for range sample {
+		choice := make([]int, len(slots))
+		for i, slot := range slots {
+			choice[i] = rng.IntN(len(slot.options))
+		}
+		requests = append(requests, expandRequest(req, slots, tail, choice, "sample", &seed))
+	}
+	return requests, nil
+}
+
+// expandRequest returns req with the options at choice substituted.
+func expandRequest(req Request, slots []wildcardSlot, tail string, choice []int, mode string, seed *int64) Request {
+	var prompt strings.Builder
+	values := make([]WildcardValue, len(slots))
+	for i, slot := range slots {
+		value := slot.options[choice[i]]
+		prompt.WriteString(slot.prefix)
+		prompt.WriteString(value)
+		values[i] = WildcardValue{Token: slot.token, Value: value}
+	}
+	prompt.WriteString(tail)
+
+	expanded := req
+	expanded.Prompt = strings.Join(strings.Fields(prompt.String()), " ")
+	expanded.Wildcards = &Wildcards{Template: req.Prompt, Mode: mode, Seed: seed, Values: values}
+	return expanded
+}
+
+// parseWildcards splits prompt into wildcard slots and the text after the
+// last one.
+func parseWildcards(roots profileRoots, prompt string) ([]wildcardSlot, string, error) {
+	var slots []wildcardSlot
+	last := 0
+	for _, match := range wildcardPattern.FindAllStringSubmatchIndex(prompt, -1) {
+		slot := wildcardSlot{prefix: prompt[last:match[0]], token: prompt[match[0]:match[1]]}
+		if match[2] >= 0 {
+			for _, option := range strings.Split(prompt[match[2]:match[3]], "|") {
+				slot.options = append(slot.options, strings.TrimSpace(option))
+			}
+		} else {
+			options, err := roots.loadWildcard(prompt[match[4]:match[5]])
+			if err != nil {
+				return nil, "", err
+			}
+			slot.options = options
+		}
+		slots = append(slots, slot)
+		last = match[1]
+	}
+	return slots, prompt[last:], nil
+}
+
+// loadWildcard reads the options of __name__ from wildcards/name.txt:
+// one per line, skipping blank lines and # comments. Unlike profiles,
+// wildcards are only looked up in wildcards/ directories, so names cannot
+// reach other files.
+func (r profileRoots) loadWildcard(name string) ([]string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return nil, WithCode(CodeUsage, fmt.Errorf("invalid wildcard name %q", name))
+	}
+
+	var data []byte
+	path := ""
+	for _, dir := range r.dirs("wildcards") {
+		candidate := filepath.Join(dir, name+".txt")
+		read, err := os.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, WithCode(CodeIO, fmt.Errorf("wildcard __%s__: %w", name, err))
+		}
+		data, path = read, candidate
+		break
+	}
+	if path == "" {
+		return nil, WithCode(CodeProfile, fmt.Errorf("wildcard __%s__: %w: wildcards/%s.txt", name, errProfileNotFound, name))
+	}
+
+	var options []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		options = append(options, line)
+	}
+	if len(options) == 0 {
+		return nil, WithCode(CodeProfile, fmt.Errorf("wildcard __%s__: %s has no entries", name, path))
+	}
+	return options, nil
+}